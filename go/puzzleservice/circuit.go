@@ -0,0 +1,591 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Electrical constants used when simulating a circuit
+const (
+	ledOnResistance        = 10.0
+	switchClosedResistance = 0.001
+	// Transistors are modelled as a base-emitter diode driving a collector
+	// current source that saturates at a small collector-emitter voltage
+	transistorBaseVoltage       = 0.7
+	transistorBaseResistance    = 10.0
+	transistorSaturationVoltage = 0.2
+	transistorOnResistance      = 1.0
+	// reverseBiasVoltage is the reverse voltage at which an LED counts as wired backwards
+	reverseBiasVoltage = 0.5
+	// minConductance ties every node weakly to ground so floating parts still solve
+	minConductance = 1e-9
+	// poweredCurrent is the smallest current that counts as a component being powered
+	poweredCurrent = 1e-4
+	// maxSolverIterations bounds the search for a consistent set of LED and transistor states
+	maxSolverIterations = 50
+)
+
+// circuitComponent is a component placed in a circuit netlist
+type circuitComponent struct {
+	Component
+	// Nodes holds the node of each pin, in the order the catalog lists them
+	Nodes []int
+}
+
+// circuitNetlist is the electrical view of a set of connections
+type circuitNetlist struct {
+	Components []circuitComponent
+	NodeCount  int
+	// Unconnected lists the pins of placed components that no wire reaches
+	Unconnected []string
+	// Connections holds the connections the netlist was built from, and
+	// Wires the same connections with both endpoints resolved to pins
+	Connections []Connection
+	Wires       []Connection
+}
+
+// component gets a component of the netlist by ID
+func (n circuitNetlist) component(id string) (circuitComponent, bool) {
+	for _, c := range n.Components {
+		if c.ID == id {
+			return c, true
+		}
+	}
+	return circuitComponent{}, false
+}
+
+// disjointSet is a union-find structure over string keys
+type disjointSet map[string]string
+
+// find returns the representative of the set containing key
+func (d disjointSet) find(key string) string {
+	parent, ok := d[key]
+	if !ok {
+		d[key] = key
+		return key
+	}
+	if parent == key {
+		return key
+	}
+	root := d.find(parent)
+	d[key] = root
+	return root
+}
+
+// union merges the sets containing a and b
+func (d disjointSet) union(a, b string) {
+	rootA, rootB := d.find(a), d.find(b)
+	if rootA != rootB {
+		d[rootA] = rootB
+	}
+}
+
+// buildNetlist builds a netlist from a set of connections, taking parts from the parts bin
+func buildNetlist(connections []Connection, parts map[string]Component) (circuitNetlist, error) {
+	netlist := circuitNetlist{Connections: connections}
+	sets := make(disjointSet)
+	resolved := make(map[string]Component)
+	connected := make(map[string]bool)
+	var order []string
+
+	// endpoint resolves a pin ("led1.anode") or a whole component ("led1") to
+	// a pin reference. A connection from A to B joins the output pin of A to
+	// the input pin of B, e.g. a battery's positive terminal to an LED's anode.
+	endpoint := func(ref string, side int) (string, error) {
+		id, pin := splitPinRef(ref)
+		part, ok := resolved[id]
+		if !ok {
+			var err error
+			part, err = resolvePart(parts, id)
+			if err != nil {
+				return "", err
+			}
+			resolved[id] = part
+			order = append(order, id)
+		}
+
+		pins := part.Pins()
+		index := 0
+		if pin != "" {
+			if index, ok = part.pinIndex(pin); !ok {
+				return "", fmt.Errorf("component '%s' has no pin '%s' (pins: %s)", id, pin, strings.Join(pins, ", "))
+			}
+		} else if len(pins) == 2 {
+			index = side
+		} else if len(pins) > 2 {
+			return "", fmt.Errorf("component '%s' must be wired by pin (pins: %s)", id, strings.Join(pins, ", "))
+		}
+
+		key := id + "." + pins[index]
+		connected[key] = true
+		return key, nil
+	}
+
+	for _, conn := range connections {
+		from, err := endpoint(conn.From, 1)
+		if err != nil {
+			return netlist, err
+		}
+		to, err := endpoint(conn.To, 0)
+		if err != nil {
+			return netlist, err
+		}
+		sets.union(from, to)
+		netlist.Wires = append(netlist.Wires, Connection{From: from, To: to})
+	}
+
+	// Number the nodes in order of first appearance
+	nodes := make(map[string]int)
+	for _, id := range order {
+		component := circuitComponent{Component: resolved[id]}
+		for _, pin := range component.Pins() {
+			key := id + "." + pin
+			if !connected[key] {
+				netlist.Unconnected = append(netlist.Unconnected, key)
+			}
+			root := sets.find(key)
+			node, ok := nodes[root]
+			if !ok {
+				node = len(nodes)
+				nodes[root] = node
+			}
+			component.Nodes = append(component.Nodes, node)
+		}
+		netlist.Components = append(netlist.Components, component)
+	}
+	netlist.NodeCount = len(nodes)
+
+	return netlist, nil
+}
+
+// maxOrientations bounds the ways of orienting components wired as a whole that are tried
+const maxOrientations = 64
+
+// orientConnections picks the pins of two-pin components wired as a whole.
+// Wires are undirected, so when their directions leave such a component's
+// pin unconnected, the ends on its other pin are tried on both pins and the
+// wiring that matches the reference circuit is kept.
+func orientConnections(connections []Connection, parts map[string]Component, reference circuitNetlist) []Connection {
+	// end is a component-level endpoint: the connection and its side, 0 for To
+	type end struct{ conn, side int }
+	ends := make(map[string][]end)
+	used := make(map[string][2]bool)
+	var order []string
+	for i, conn := range connections {
+		for side, ref := range []string{conn.To, conn.From} {
+			id, pin := splitPinRef(ref)
+			part, err := resolvePart(parts, id)
+			if err != nil || len(part.Pins()) != 2 {
+				continue
+			}
+			if _, seen := used[id]; !seen {
+				order = append(order, id)
+			}
+			pins := used[id]
+			if pin == "" {
+				ends[id] = append(ends[id], end{i, side})
+				pins[side] = true
+			} else if index, ok := part.pinIndex(pin); ok {
+				pins[index] = true
+			}
+			used[id] = pins
+		}
+	}
+
+	// Each choice moves a non-empty set of the ends on the busy pin to the free one
+	type choice struct {
+		id    string
+		moves [][]end
+	}
+	var choices []choice
+	combinations := 1
+	for _, id := range order {
+		pins := used[id]
+		if pins[0] == pins[1] {
+			continue
+		}
+		busy := 0
+		if pins[1] {
+			busy = 1
+		}
+		var candidates []end
+		for _, e := range ends[id] {
+			if e.side == busy {
+				candidates = append(candidates, e)
+			}
+		}
+		if len(candidates) < 2 {
+			continue
+		}
+		c := choice{id: id}
+		for mask := 1; mask < 1<<uint(len(candidates))-1; mask++ {
+			var moved []end
+			for k, e := range candidates {
+				if mask&(1<<uint(k)) != 0 {
+					moved = append(moved, e)
+				}
+			}
+			c.moves = append(c.moves, moved)
+		}
+		combinations *= len(c.moves)
+		if combinations > maxOrientations {
+			return connections
+		}
+		choices = append(choices, c)
+	}
+	if len(choices) == 0 {
+		return connections
+	}
+
+	var first []Connection
+	for n := 0; n < combinations; n++ {
+		oriented := append([]Connection(nil), connections...)
+		rest := n
+		for _, c := range choices {
+			part, _ := resolvePart(parts, c.id)
+			for _, e := range c.moves[rest%len(c.moves)] {
+				ref := c.id + "." + part.Pins()[1-e.side]
+				if e.side == 0 {
+					oriented[e.conn].To = ref
+				} else {
+					oriented[e.conn].From = ref
+				}
+			}
+			rest /= len(c.moves)
+		}
+		netlist, err := buildNetlist(oriented, parts)
+		if err != nil {
+			continue
+		}
+		if _, ok := matchCircuits(netlist, reference); ok {
+			return oriented
+		}
+		if first == nil {
+			first = oriented
+		}
+	}
+	if first == nil {
+		return connections
+	}
+	return first
+}
+
+// circuitOperatingPoint holds the solved DC state of a circuit
+type circuitOperatingPoint struct {
+	// Voltages holds the voltage of each node
+	Voltages []float64
+	// Currents holds the current through each component from its first pin
+	// to its second, or into the collector of a transistor
+	Currents map[string]float64
+	// Powered tells whether each component carries current
+	Powered map[string]bool
+}
+
+// PowerStates returns the power state of every component, sorted by ID
+func (op circuitOperatingPoint) PowerStates() []PowerState {
+	states := make([]PowerState, 0, len(op.Powered))
+	for id, powered := range op.Powered {
+		states = append(states, PowerState{ComponentID: id, Powered: powered})
+	}
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].ComponentID < states[j].ComponentID
+	})
+	return states
+}
+
+// drop returns the voltage from the first pin of a component to its second
+func (op circuitOperatingPoint) drop(c circuitComponent) float64 {
+	return op.Voltages[c.Nodes[0]] - op.Voltages[c.Nodes[1]]
+}
+
+// transistorState is the operating region of a transistor
+type transistorState int
+
+const (
+	transistorOff transistorState = iota
+	transistorActive
+	transistorSaturated
+)
+
+// simulateNetlist solves the steady-state DC operating point of a netlist
+func simulateNetlist(netlist circuitNetlist) (circuitOperatingPoint, error) {
+	return solveNetlist(netlist, nil)
+}
+
+// solveNetlist solves a netlist either in steady state or, given the state
+// of the previous time step, for the next step of a transient simulation
+func solveNetlist(netlist circuitNetlist, state *transientState) (circuitOperatingPoint, error) {
+	op := circuitOperatingPoint{
+		Currents: make(map[string]float64),
+		Powered:  make(map[string]bool),
+	}
+
+	// Each battery adds a branch current unknown after the node voltages
+	branches := make(map[string]int)
+	for _, c := range netlist.Components {
+		if c.Kind == KindBattery {
+			branches[c.ID] = netlist.NodeCount + len(branches)
+		}
+	}
+
+	ledOn := make(map[string]bool)
+	transistors := make(map[string]transistorState)
+	var x []float64
+	converged := false
+	for iteration := 0; iteration < maxSolverIterations && !converged; iteration++ {
+		system := newLinearSystem(netlist.NodeCount + len(branches))
+		for node := 0; node < netlist.NodeCount; node++ {
+			system.addConductance(node, -1, minConductance)
+		}
+
+		for _, c := range netlist.Components {
+			switch c.Kind {
+			case KindBattery:
+				// Vpos - Vneg - r*I = V, where I flows into the positive terminal
+				neg, pos := c.Nodes[0], c.Nodes[1]
+				branch := branches[c.ID]
+				system.A[pos][branch] += 1
+				system.A[neg][branch] -= 1
+				system.A[branch][pos] += 1
+				system.A[branch][neg] -= 1
+				system.A[branch][branch] -= c.InternalResistance
+				system.B[branch] = c.Voltage
+			case KindResistor, KindBuzzer, KindMotor:
+				system.addConductance(c.Nodes[0], c.Nodes[1], 1/c.Resistance)
+			case KindSwitch:
+				if *c.Closed {
+					system.addConductance(c.Nodes[0], c.Nodes[1], 1/switchClosedResistance)
+				}
+			case KindLED:
+				anode, cathode := c.Nodes[0], c.Nodes[1]
+				if ledOn[c.ID] {
+					// Forward voltage in series with the on resistance
+					g := 1 / ledOnResistance
+					system.addConductance(anode, cathode, g)
+					system.addCurrent(cathode, anode, g*c.ForwardVoltage)
+				} else {
+					system.addConductance(anode, cathode, minConductance)
+				}
+			case KindTransistor:
+				stampTransistor(system, c, transistors[c.ID])
+			case KindCapacitor, KindInductor:
+				g, source := state.companion(c)
+				system.addConductance(c.Nodes[0], c.Nodes[1], g)
+				system.addCurrent(c.Nodes[0], c.Nodes[1], source)
+			}
+		}
+
+		var err error
+		x, err = system.solve()
+		if err != nil {
+			return op, err
+		}
+
+		// Check that every LED and transistor state agrees with the solved voltages
+		converged = true
+		for _, c := range netlist.Components {
+			switch c.Kind {
+			case KindLED:
+				drop := x[c.Nodes[0]] - x[c.Nodes[1]]
+				if ledOn[c.ID] && drop < c.ForwardVoltage {
+					ledOn[c.ID] = false
+					converged = false
+				} else if !ledOn[c.ID] && drop > c.ForwardVoltage {
+					ledOn[c.ID] = true
+					converged = false
+				}
+			case KindTransistor:
+				next := nextTransistorState(c, transistors[c.ID], x)
+				if next != transistors[c.ID] {
+					transistors[c.ID] = next
+					converged = false
+				}
+			}
+		}
+	}
+	if !converged {
+		return op, fmt.Errorf("circuit simulation did not converge")
+	}
+
+	op.Voltages = x[:netlist.NodeCount]
+	for _, c := range netlist.Components {
+		var current float64
+		switch c.Kind {
+		case KindBattery:
+			current = -x[branches[c.ID]]
+		case KindResistor, KindBuzzer, KindMotor:
+			current = op.drop(c) / c.Resistance
+		case KindSwitch:
+			if *c.Closed {
+				current = op.drop(c) / switchClosedResistance
+			}
+		case KindLED:
+			if ledOn[c.ID] {
+				current = (op.drop(c) - c.ForwardVoltage) / ledOnResistance
+			} else {
+				current = op.drop(c) * minConductance
+			}
+		case KindTransistor:
+			_, current = transistorCurrents(c, transistors[c.ID], x)
+		case KindCapacitor, KindInductor:
+			g, source := state.companion(c)
+			current = g*op.drop(c) + source
+		}
+		op.Currents[c.ID] = current
+		op.Powered[c.ID] = math.Abs(current) > poweredCurrent
+	}
+
+	// A junction is powered when anything attached to it is
+	for _, junction := range netlist.Components {
+		if junction.Kind != KindJunction {
+			continue
+		}
+		for _, c := range netlist.Components {
+			if c.Kind == KindJunction || !op.Powered[c.ID] {
+				continue
+			}
+			for _, node := range c.Nodes {
+				if node == junction.Nodes[0] {
+					op.Powered[junction.ID] = true
+				}
+			}
+		}
+	}
+
+	return op, nil
+}
+
+// stampTransistor adds a transistor in the given state to the system
+func stampTransistor(system *linearSystem, c circuitComponent, state transistorState) {
+	base, collector, emitter := c.Nodes[0], c.Nodes[1], c.Nodes[2]
+	if state == transistorOff {
+		system.addConductance(base, emitter, minConductance)
+		system.addConductance(collector, emitter, minConductance)
+		return
+	}
+
+	// The base-emitter junction conducts like a diode
+	g := 1 / transistorBaseResistance
+	system.addConductance(base, emitter, g)
+	system.addCurrent(emitter, base, g*transistorBaseVoltage)
+
+	if state == transistorActive {
+		// Collector current is the gain times the base current, which
+		// depends on the base-emitter voltage
+		gm := c.Gain * g
+		system.A[collector][base] += gm
+		system.A[collector][emitter] -= gm
+		system.A[emitter][base] -= gm
+		system.A[emitter][emitter] += gm
+		system.addCurrent(collector, emitter, -gm*transistorBaseVoltage)
+		return
+	}
+
+	// A saturated transistor is a closed switch with a small voltage drop
+	gce := 1 / transistorOnResistance
+	system.addConductance(collector, emitter, gce)
+	system.addCurrent(emitter, collector, gce*transistorSaturationVoltage)
+}
+
+// transistorCurrents returns the base and collector currents of a transistor in the given state
+func transistorCurrents(c circuitComponent, state transistorState, x []float64) (float64, float64) {
+	base, collector, emitter := x[c.Nodes[0]], x[c.Nodes[1]], x[c.Nodes[2]]
+	switch state {
+	case transistorActive:
+		ib := (base - emitter - transistorBaseVoltage) / transistorBaseResistance
+		return ib, c.Gain * ib
+	case transistorSaturated:
+		ib := (base - emitter - transistorBaseVoltage) / transistorBaseResistance
+		return ib, (collector - emitter - transistorSaturationVoltage) / transistorOnResistance
+	}
+	return 0, (collector - emitter) * minConductance
+}
+
+// nextTransistorState picks the operating region that agrees with the solved voltages
+func nextTransistorState(c circuitComponent, state transistorState, x []float64) transistorState {
+	vbe := x[c.Nodes[0]] - x[c.Nodes[2]]
+	vce := x[c.Nodes[1]] - x[c.Nodes[2]]
+	ib, ic := transistorCurrents(c, state, x)
+
+	switch state {
+	case transistorOff:
+		if vbe > transistorBaseVoltage {
+			return transistorActive
+		}
+	case transistorActive:
+		if ib < 0 {
+			return transistorOff
+		}
+		if vce < transistorSaturationVoltage {
+			return transistorSaturated
+		}
+	case transistorSaturated:
+		if ib < 0 {
+			return transistorOff
+		}
+		if ic > c.Gain*ib {
+			return transistorActive
+		}
+	}
+	return state
+}
+
+// simulateCircuit builds and solves the netlist for a set of connections
+func simulateCircuit(connections []Connection, parts map[string]Component) (circuitNetlist, circuitOperatingPoint, error) {
+	netlist, err := buildNetlist(connections, parts)
+	if err != nil {
+		return netlist, circuitOperatingPoint{}, err
+	}
+	op, err := simulateNetlist(netlist)
+	return netlist, op, err
+}
+
+// reversedLEDs returns the IDs of LEDs whose cathode sits at a higher voltage than their anode
+func reversedLEDs(netlist circuitNetlist, op circuitOperatingPoint) []string {
+	var reversed []string
+	for _, c := range netlist.Components {
+		if c.Kind == KindLED && op.drop(c) < -reverseBiasVoltage {
+			reversed = append(reversed, c.ID)
+		}
+	}
+	return reversed
+}
+
+// compareOperatingPoints checks that every component of the expected circuit
+// is powered the same way and carries the same current in the submitted one.
+// Junctions are only wiring points and are skipped. It returns a description
+// of the first difference, or an empty string.
+func compareOperatingPoints(submitted, expected circuitOperatingPoint, reference circuitNetlist) string {
+	var ids []string
+	for _, c := range reference.Components {
+		if c.Kind != KindJunction {
+			ids = append(ids, c.ID)
+		}
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		if submitted.Powered[id] != expected.Powered[id] {
+			if expected.Powered[id] {
+				return fmt.Sprintf("Component '%s' should be powered", id)
+			}
+			return fmt.Sprintf("Component '%s' should not be powered", id)
+		}
+	}
+
+	for _, id := range ids {
+		if !expected.Powered[id] {
+			continue
+		}
+
+		got := math.Abs(submitted.Currents[id])
+		want := math.Abs(expected.Currents[id])
+		if math.Abs(got-want) > poweredCurrent && math.Abs(got-want) > 0.05*want {
+			return fmt.Sprintf("Current through '%s' is %.1f mA, expected %.1f mA", id, got*1000, want*1000)
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ComponentKind identifies how a circuit component behaves electrically
+type ComponentKind string
+
+const (
+	KindBattery    ComponentKind = "battery"
+	KindResistor   ComponentKind = "resistor"
+	KindLED        ComponentKind = "led"
+	KindSwitch     ComponentKind = "switch"
+	KindJunction   ComponentKind = "junction"
+	KindBuzzer     ComponentKind = "buzzer"
+	KindMotor      ComponentKind = "motor"
+	KindTransistor ComponentKind = "transistor"
+	KindCapacitor  ComponentKind = "capacitor"
+	KindInductor   ComponentKind = "inductor"
+)
+
+// Component represents a part in a circuit puzzle's parts bin.
+// Parameters left at zero take the catalog default for the component's kind.
+type Component struct {
+	ID   string        `json:"id,omitempty"`
+	Kind ComponentKind `json:"kind"`
+	// Voltage is the open-circuit voltage of a battery in volts
+	Voltage float64 `json:"voltage,omitempty"`
+	// InternalResistance is the internal resistance of a battery in ohms
+	InternalResistance float64 `json:"internalResistance,omitempty"`
+	// Resistance is the resistance of a resistor, buzzer or motor, or the
+	// winding resistance of an inductor, in ohms
+	Resistance float64 `json:"resistance,omitempty"`
+	// ForwardVoltage is the forward voltage of an LED in volts
+	ForwardVoltage float64 `json:"forwardVoltage,omitempty"`
+	// MaxCurrent is the rated current of an LED, buzzer, motor or transistor in amps
+	MaxCurrent float64 `json:"maxCurrent,omitempty"`
+	// MaxPower is the power rating of a resistor in watts
+	MaxPower float64 `json:"maxPower,omitempty"`
+	// MaxReverseVoltage is the reverse voltage an LED survives in volts
+	MaxReverseVoltage float64 `json:"maxReverseVoltage,omitempty"`
+	// Gain is the current gain (beta) of a transistor
+	Gain float64 `json:"gain,omitempty"`
+	// Capacitance is the capacitance of a capacitor in farads
+	Capacitance float64 `json:"capacitance,omitempty"`
+	// Inductance is the inductance of an inductor in henries
+	Inductance float64 `json:"inductance,omitempty"`
+	// Closed is the state of a switch (closed by default)
+	Closed *bool `json:"closed,omitempty"`
+}
+
+// ComponentSpec describes a kind of component in the catalog
+type ComponentSpec struct {
+	Kind        ComponentKind `json:"kind"`
+	Description string        `json:"description"`
+	// Pins lists the pin names; two-pin components list their input pin first
+	Pins     []string  `json:"pins"`
+	Defaults Component `json:"defaults"`
+}
+
+// componentCatalog lists every supported component kind with its default parameters
+var componentCatalog = map[ComponentKind]ComponentSpec{
+	KindBattery: {
+		Description: "DC voltage source with internal resistance",
+		Pins:        []string{"negative", "positive"},
+		Defaults:    Component{Voltage: 9.0, InternalResistance: 0.5},
+	},
+	KindResistor: {
+		Description: "Fixed resistor",
+		Pins:        []string{"a", "b"},
+		Defaults:    Component{Resistance: 470.0, MaxPower: 0.25},
+	},
+	KindLED: {
+		Description: "Light-emitting diode, conducting from anode to cathode",
+		Pins:        []string{"anode", "cathode"},
+		Defaults:    Component{ForwardVoltage: 2.0, MaxCurrent: 0.02, MaxReverseVoltage: 5.0},
+	},
+	KindSwitch: {
+		Description: "Single-pole switch",
+		Pins:        []string{"a", "b"},
+		Defaults:    Component{Closed: boolPtr(true)},
+	},
+	KindJunction: {
+		Description: "Point joining several wires",
+		Pins:        []string{"node"},
+	},
+	KindBuzzer: {
+		Description: "Piezo buzzer, modelled as a resistive load",
+		Pins:        []string{"positive", "negative"},
+		Defaults:    Component{Resistance: 200.0, MaxCurrent: 0.03},
+	},
+	KindMotor: {
+		Description: "DC motor, modelled as a resistive load",
+		Pins:        []string{"a", "b"},
+		Defaults:    Component{Resistance: 30.0, MaxCurrent: 0.5},
+	},
+	KindTransistor: {
+		Description: "NPN bipolar transistor, switching collector to emitter when base current flows",
+		Pins:        []string{"base", "collector", "emitter"},
+		Defaults:    Component{Gain: 100, MaxCurrent: 0.5},
+	},
+	KindCapacitor: {
+		Description: "Capacitor, open in steady state and charging over time in transient simulation",
+		Pins:        []string{"a", "b"},
+		Defaults:    Component{Capacitance: 100e-6},
+	},
+	KindInductor: {
+		Description: "Inductor with winding resistance, resisting changes in current in transient simulation",
+		Pins:        []string{"a", "b"},
+		Defaults:    Component{Inductance: 10e-3, Resistance: 1.0},
+	},
+}
+
+// boolPtr returns a pointer to b
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+// ComponentCatalog returns the catalog of component kinds, sorted by kind
+func ComponentCatalog() []ComponentSpec {
+	specs := make([]ComponentSpec, 0, len(componentCatalog))
+	for kind, spec := range componentCatalog {
+		spec.Kind = kind
+		spec.Defaults.Kind = kind
+		specs = append(specs, spec)
+	}
+	sort.Slice(specs, func(i, j int) bool {
+		return specs[i].Kind < specs[j].Kind
+	})
+	return specs
+}
+
+// componentKindFromID infers the kind of a component from its ID (e.g. "led1" is an LED)
+func componentKindFromID(id string) (ComponentKind, bool) {
+	kind := ComponentKind(strings.ToLower(strings.TrimRight(id, "0123456789")))
+	if _, ok := componentCatalog[kind]; !ok {
+		return "", false
+	}
+	return kind, true
+}
+
+// withDefaults fills the unset parameters of a component from the catalog
+func (c Component) withDefaults() Component {
+	defaults := componentCatalog[c.Kind].Defaults
+	if c.Voltage == 0 {
+		c.Voltage = defaults.Voltage
+	}
+	if c.InternalResistance == 0 {
+		c.InternalResistance = defaults.InternalResistance
+	}
+	if c.Resistance == 0 {
+		c.Resistance = defaults.Resistance
+	}
+	if c.ForwardVoltage == 0 {
+		c.ForwardVoltage = defaults.ForwardVoltage
+	}
+	if c.MaxCurrent == 0 {
+		c.MaxCurrent = defaults.MaxCurrent
+	}
+	if c.MaxPower == 0 {
+		c.MaxPower = defaults.MaxPower
+	}
+	if c.MaxReverseVoltage == 0 {
+		c.MaxReverseVoltage = defaults.MaxReverseVoltage
+	}
+	if c.Gain == 0 {
+		c.Gain = defaults.Gain
+	}
+	if c.Capacitance == 0 {
+		c.Capacitance = defaults.Capacitance
+	}
+	if c.Inductance == 0 {
+		c.Inductance = defaults.Inductance
+	}
+	if c.Closed == nil {
+		c.Closed = defaults.Closed
+	}
+	return c
+}
+
+// validateComponents checks that a parts bin only holds known, uniquely named components
+func validateComponents(components []Component) error {
+	seen := make(map[string]bool)
+	for _, c := range components {
+		if c.ID == "" {
+			return fmt.Errorf("component without an ID")
+		}
+		if seen[c.ID] {
+			return fmt.Errorf("duplicate component ID '%s'", c.ID)
+		}
+		seen[c.ID] = true
+
+		if _, ok := componentCatalog[c.Kind]; !ok {
+			return fmt.Errorf("component '%s' has unknown kind '%s'", c.ID, c.Kind)
+		}
+		if c.Voltage < 0 || c.InternalResistance < 0 || c.Resistance < 0 || c.ForwardVoltage < 0 || c.MaxCurrent < 0 ||
+			c.MaxPower < 0 || c.MaxReverseVoltage < 0 || c.Gain < 0 || c.Capacitance < 0 || c.Inductance < 0 {
+			return fmt.Errorf("component '%s' has a negative parameter", c.ID)
+		}
+	}
+	return nil
+}
+
+// circuitParts resolves a parts bin into components with every parameter set, keyed by ID
+func circuitParts(components []Component) map[string]Component {
+	parts := make(map[string]Component, len(components))
+	for _, c := range components {
+		parts[c.ID] = c.withDefaults()
+	}
+	return parts
+}
+
+// resolvePart looks up a component in the parts bin, falling back to
+// inferring its kind from the ID for puzzles without a parts bin
+func resolvePart(parts map[string]Component, id string) (Component, error) {
+	if part, ok := parts[id]; ok {
+		return part, nil
+	}
+	kind, ok := componentKindFromID(id)
+	if !ok {
+		return Component{}, fmt.Errorf("unknown component type for '%s'", id)
+	}
+	return Component{ID: id, Kind: kind}.withDefaults(), nil
+}
+
+// Pins returns the pin names of the component
+func (c Component) Pins() []string {
+	return componentCatalog[c.Kind].Pins
+}
+
+// pinIndex returns the position of a named pin of the component
+func (c Component) pinIndex(pin string) (int, bool) {
+	for i, name := range c.Pins() {
+		if name == pin {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// splitPinRef splits a connection endpoint such as "led1.anode" into the
+// component ID and pin name; the pin is empty for component-level endpoints
+func splitPinRef(ref string) (string, string) {
+	if i := strings.Index(ref, "."); i >= 0 {
+		return ref[:i], ref[i+1:]
+	}
+	return ref, ""
+}
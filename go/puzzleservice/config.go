@@ -14,6 +14,8 @@ type ConfigPaths struct {
 	PuzzlesDir string
 	// PrivateConfigPath is the path to the private config file
 	PrivateConfigPath string
+	// SessionsDir is the directory holding the state of interactive maze sessions
+	SessionsDir string
 }
 
 // DefaultConfigPaths returns the default config paths
@@ -30,6 +32,8 @@ func DefaultConfigPaths() ConfigPaths {
 		PuzzlesDir: filepath.Join(homeDir, ".jemulator", "puzzles"),
 		// Private config file
 		PrivateConfigPath: filepath.Join(homeDir, ".jemulator", "config.json"),
+		// Maze session state
+		SessionsDir: filepath.Join(homeDir, ".jemulator", "sessions"),
 	}
 }
 
@@ -40,6 +44,11 @@ func EnsureConfigDirs(paths ConfigPaths) error {
 		return fmt.Errorf("failed to create puzzles directory: %v", err)
 	}
 
+	// Create sessions directory if it doesn't exist
+	if err := os.MkdirAll(paths.SessionsDir, 0755); err != nil {
+		return fmt.Errorf("failed to create sessions directory: %v", err)
+	}
+
 	// Create parent directory for private config if it doesn't exist
 	configDir := filepath.Dir(paths.PrivateConfigPath)
 	if err := os.MkdirAll(configDir, 0755); err != nil {
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Constraint types
+const (
+	constraintEqual        = "equal"
+	constraintNotEqual     = "notEqual"
+	constraintAllDifferent = "allDifferent"
+	constraintAdjacent     = "adjacent"
+	constraintImplies      = "implies"
+)
+
+// ConstraintValue is a value of a constraint variable, either a string or an integer
+type ConstraintValue struct {
+	Str   string
+	Int   int
+	IsInt bool
+}
+
+// UnmarshalJSON reads a JSON string or integer
+func (v *ConstraintValue) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err == nil {
+		*v = ConstraintValue{Str: str}
+		return nil
+	}
+	var n int
+	if err := json.Unmarshal(data, &n); err != nil {
+		return fmt.Errorf("value %s is neither a string nor an integer", string(data))
+	}
+	*v = ConstraintValue{Int: n, IsInt: true}
+	return nil
+}
+
+// MarshalJSON writes the value as a JSON string or integer
+func (v ConstraintValue) MarshalJSON() ([]byte, error) {
+	if v.IsInt {
+		return json.Marshal(v.Int)
+	}
+	return json.Marshal(v.Str)
+}
+
+// String formats the value for messages
+func (v ConstraintValue) String() string {
+	if v.IsInt {
+		return strconv.Itoa(v.Int)
+	}
+	return v.Str
+}
+
+// ConstraintVariable is a variable of a constraint puzzle and the values it may take
+type ConstraintVariable struct {
+	Name   string            `json:"name"`
+	Domain []ConstraintValue `json:"domain"`
+}
+
+// Constraint is a named condition on the variables of a constraint puzzle:
+//   - equal and notEqual compare two variables, or one variable with Value
+//   - allDifferent requires its variables to take distinct values
+//   - adjacent requires two variables, or one variable and Value, to be
+//     neighbours: integers one apart, or strings next to each other in the domain
+//   - implies requires Then to hold whenever If holds
+type Constraint struct {
+	Name      string           `json:"name,omitempty"`
+	Type      string           `json:"type"`
+	Variables []string         `json:"variables,omitempty"`
+	Value     *ConstraintValue `json:"value,omitempty"`
+	If        *Constraint      `json:"if,omitempty"`
+	Then      *Constraint      `json:"then,omitempty"`
+}
+
+// ConstraintSolution represents a solution for a constraint puzzle
+type ConstraintSolution struct {
+	Values map[string]ConstraintValue `json:"values"`
+}
+
+// constraintName returns the name of the constraint at an index of the puzzle
+func constraintName(constraint Constraint, index int) string {
+	if constraint.Name != "" {
+		return constraint.Name
+	}
+	return fmt.Sprintf("constraint %d", index+1)
+}
+
+// validateConstraints checks that the variables and constraints of a constraint puzzle are well formed
+func validateConstraints(variables []ConstraintVariable, constraints []Constraint) error {
+	domains := make(map[string][]ConstraintValue, len(variables))
+	for _, variable := range variables {
+		if variable.Name == "" {
+			return fmt.Errorf("variable without a name")
+		}
+		if _, ok := domains[variable.Name]; ok {
+			return fmt.Errorf("duplicate variable '%s'", variable.Name)
+		}
+		if len(variable.Domain) == 0 {
+			return fmt.Errorf("variable '%s' has an empty domain", variable.Name)
+		}
+		for _, value := range variable.Domain[1:] {
+			if value.IsInt != variable.Domain[0].IsInt {
+				return fmt.Errorf("variable '%s' mixes strings and integers in its domain", variable.Name)
+			}
+		}
+		domains[variable.Name] = variable.Domain
+	}
+
+	for i, constraint := range constraints {
+		if err := validateConstraint(constraint, domains); err != nil {
+			return fmt.Errorf("%s: %v", constraintName(constraint, i), err)
+		}
+	}
+	return nil
+}
+
+// validateConstraint checks a single constraint against the variable domains
+func validateConstraint(constraint Constraint, domains map[string][]ConstraintValue) error {
+	for _, name := range constraint.Variables {
+		if _, ok := domains[name]; !ok {
+			return fmt.Errorf("unknown variable '%s'", name)
+		}
+	}
+
+	switch constraint.Type {
+	case constraintEqual, constraintNotEqual, constraintAdjacent:
+		switch {
+		case len(constraint.Variables) == 2 && constraint.Value == nil:
+			a, b := domains[constraint.Variables[0]], domains[constraint.Variables[1]]
+			if a[0].IsInt != b[0].IsInt {
+				return fmt.Errorf("compares a string variable with an integer variable")
+			}
+			if constraint.Type == constraintAdjacent && !a[0].IsInt && !sameDomain(a, b) {
+				return fmt.Errorf("string variables must share a domain to be adjacent")
+			}
+		case len(constraint.Variables) == 1 && constraint.Value != nil:
+			if domains[constraint.Variables[0]][0].IsInt != constraint.Value.IsInt {
+				return fmt.Errorf("compares '%s' with a value of the wrong kind", constraint.Variables[0])
+			}
+		default:
+			return fmt.Errorf("%s takes two variables, or one variable and a value", constraint.Type)
+		}
+	case constraintAllDifferent:
+		if len(constraint.Variables) < 2 {
+			return fmt.Errorf("%s takes at least two variables", constraint.Type)
+		}
+	case constraintImplies:
+		if constraint.If == nil || constraint.Then == nil {
+			return fmt.Errorf("%s needs an 'if' and a 'then' constraint", constraint.Type)
+		}
+		if err := validateConstraint(*constraint.If, domains); err != nil {
+			return fmt.Errorf("if: %v", err)
+		}
+		if err := validateConstraint(*constraint.Then, domains); err != nil {
+			return fmt.Errorf("then: %v", err)
+		}
+	default:
+		return fmt.Errorf("unknown constraint type '%s'", constraint.Type)
+	}
+	return nil
+}
+
+// sameDomain tells whether two domains list the same values in the same order
+func sameDomain(a, b []ConstraintValue) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// domainIndex returns the position of a value in a domain, or -1
+func domainIndex(domain []ConstraintValue, value ConstraintValue) int {
+	for i, candidate := range domain {
+		if candidate == value {
+			return i
+		}
+	}
+	return -1
+}
+
+// holds tells whether a constraint is satisfied by an assignment of every variable
+func (c Constraint) holds(values map[string]ConstraintValue, domains map[string][]ConstraintValue) bool {
+	// operands returns the two values compared by equal, notEqual and adjacent
+	operands := func() (ConstraintValue, ConstraintValue) {
+		if c.Value != nil {
+			return values[c.Variables[0]], *c.Value
+		}
+		return values[c.Variables[0]], values[c.Variables[1]]
+	}
+
+	switch c.Type {
+	case constraintEqual:
+		a, b := operands()
+		return a == b
+	case constraintNotEqual:
+		a, b := operands()
+		return a != b
+	case constraintAllDifferent:
+		seen := make(map[ConstraintValue]bool, len(c.Variables))
+		for _, name := range c.Variables {
+			if seen[values[name]] {
+				return false
+			}
+			seen[values[name]] = true
+		}
+		return true
+	case constraintAdjacent:
+		a, b := operands()
+		if a.IsInt {
+			return abs(a.Int-b.Int) == 1
+		}
+		domain := domains[c.Variables[0]]
+		i, j := domainIndex(domain, a), domainIndex(domain, b)
+		return i >= 0 && j >= 0 && abs(i-j) == 1
+	case constraintImplies:
+		return !c.If.holds(values, domains) || c.Then.holds(values, domains)
+	}
+	return false
+}
+
+// verifyConstraints checks that a submitted assignment gives every variable
+// a value from its domain and reports every constraint it violates
+func verifyConstraints(result PuzzleVerificationResult, variables []ConstraintVariable, constraints []Constraint, values map[string]ConstraintValue) PuzzleVerificationResult {
+	domains := make(map[string][]ConstraintValue, len(variables))
+	for _, variable := range variables {
+		domains[variable.Name] = variable.Domain
+		value, ok := values[variable.Name]
+		if !ok {
+			result.Message = fmt.Sprintf("Value for '%s' is missing", variable.Name)
+			return result
+		}
+		if domainIndex(variable.Domain, value) < 0 {
+			result.Message = fmt.Sprintf("'%s' is not a possible value of '%s'", value, variable.Name)
+			return result
+		}
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, ok := domains[name]; !ok {
+			result.Message = fmt.Sprintf("'%s' is not a variable of this puzzle", name)
+			return result
+		}
+	}
+
+	for i, constraint := range constraints {
+		if !constraint.holds(values, domains) {
+			result.ViolatedConstraints = append(result.ViolatedConstraints, constraintName(constraint, i))
+		}
+	}
+	if len(result.ViolatedConstraints) > 0 {
+		result.Message = fmt.Sprintf("%d of %d constraints are violated: %s",
+			len(result.ViolatedConstraints), len(constraints), strings.Join(result.ViolatedConstraints, "; "))
+		return result
+	}
+
+	result.Valid = true
+	result.Message = "Constraint solution is correct"
+	return result
+}
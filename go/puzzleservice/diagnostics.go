@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// CircuitDiagnostics details what is wrong with a circuit submission, so
+// that front ends can highlight the offending wires and parts
+type CircuitDiagnostics struct {
+	// MissingConnections lists stored connections whose endpoints the submission leaves apart
+	MissingConnections []Connection `json:"missingConnections,omitempty"`
+	// ExtraConnections lists submitted connections joining endpoints the stored circuit keeps apart
+	ExtraConnections []Connection `json:"extraConnections,omitempty"`
+	// UnknownComponents lists submitted component IDs that are not part of the puzzle
+	UnknownComponents    []string             `json:"unknownComponents,omitempty"`
+	PowerStateMismatches []PowerStateMismatch `json:"powerStateMismatches,omitempty"`
+	// NodeVoltages gives the voltage of the node each submitted pin is on,
+	// keyed by pin and measured from the first battery's negative terminal
+	NodeVoltages map[string]float64 `json:"nodeVoltages,omitempty"`
+}
+
+// PowerStateMismatch represents a component powered differently than expected
+type PowerStateMismatch struct {
+	ComponentID string `json:"componentId"`
+	Expected    bool   `json:"expected"`
+	Actual      bool   `json:"actual"`
+}
+
+// summary describes the diagnostics in a few words, e.g. "1 missing and 2 extra connections"
+func (d CircuitDiagnostics) summary() string {
+	var parts []string
+	if len(d.MissingConnections) > 0 {
+		parts = append(parts, fmt.Sprintf("%d missing", len(d.MissingConnections)))
+	}
+	if len(d.ExtraConnections) > 0 {
+		parts = append(parts, fmt.Sprintf("%d extra", len(d.ExtraConnections)))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	if len(d.MissingConnections)+len(d.ExtraConnections) == 1 {
+		return parts[0] + " connection"
+	}
+	return strings.Join(parts, " and ") + " connections"
+}
+
+// unknownComponents lists the component IDs used by the connections that
+// are not in the parts bin or, without a parts bin, have no known kind
+func unknownComponents(connections []Connection, parts map[string]Component) []string {
+	var unknown []string
+	seen := make(map[string]bool)
+	for _, conn := range connections {
+		for _, ref := range []string{conn.From, conn.To} {
+			id, _ := splitPinRef(ref)
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+
+			known := false
+			if len(parts) > 0 {
+				_, known = parts[id]
+			} else {
+				_, known = componentKindFromID(id)
+			}
+			if !known {
+				unknown = append(unknown, id)
+			}
+		}
+	}
+	return unknown
+}
+
+// pinNodes maps every pin reference of the netlist to its node
+func (n circuitNetlist) pinNodes() map[string]int {
+	nodes := make(map[string]int)
+	for _, c := range n.Components {
+		for k, node := range c.Nodes {
+			nodes[c.ID+"."+c.Pins()[k]] = node
+		}
+	}
+	return nodes
+}
+
+// joins tells whether a wire's endpoints share a node in the given pin map
+func joins(nodes map[string]int, wire Connection) bool {
+	from, okFrom := nodes[wire.From]
+	to, okTo := nodes[wire.To]
+	return okFrom && okTo && from == to
+}
+
+// diagnoseCircuit compares a submitted circuit with the stored one wire by
+// wire and component by component. Wires are compared by the nodes they
+// join, so the same node wired in a different order is not reported.
+func diagnoseCircuit(submitted, reference circuitNetlist, submittedPoint, referencePoint circuitOperatingPoint) *CircuitDiagnostics {
+	diagnostics := &CircuitDiagnostics{
+		PowerStateMismatches: diagnosePowerStates(submittedPoint, referencePoint, reference),
+	}
+
+	submittedNodes := submitted.pinNodes()
+	for i, wire := range reference.Wires {
+		if !joins(submittedNodes, wire) {
+			diagnostics.MissingConnections = append(diagnostics.MissingConnections, reference.Connections[i])
+		}
+	}
+
+	referenceNodes := reference.pinNodes()
+	for i, wire := range submitted.Wires {
+		if !joins(referenceNodes, wire) {
+			diagnostics.ExtraConnections = append(diagnostics.ExtraConnections, submitted.Connections[i])
+		}
+	}
+
+	ground := 0.0
+	for _, c := range submitted.Components {
+		if c.Kind == KindBattery {
+			ground = submittedPoint.Voltages[c.Nodes[0]]
+			break
+		}
+	}
+	diagnostics.NodeVoltages = make(map[string]float64)
+	for _, c := range submitted.Components {
+		for i, pin := range c.Pins() {
+			voltage := submittedPoint.Voltages[c.Nodes[i]] - ground
+			diagnostics.NodeVoltages[c.ID+"."+pin] = math.Round(voltage*1000) / 1000
+		}
+	}
+
+	return diagnostics
+}
+
+// diagnosePowerStates lists the components of the stored circuit that are
+// powered differently in the submitted one; junctions are skipped
+func diagnosePowerStates(submitted, expected circuitOperatingPoint, reference circuitNetlist) []PowerStateMismatch {
+	var mismatches []PowerStateMismatch
+	for _, c := range reference.Components {
+		if c.Kind == KindJunction || submitted.Powered[c.ID] == expected.Powered[c.ID] {
+			continue
+		}
+		mismatches = append(mismatches, PowerStateMismatch{
+			ComponentID: c.ID,
+			Expected:    expected.Powered[c.ID],
+			Actual:      submitted.Powered[c.ID],
+		})
+	}
+	sort.Slice(mismatches, func(i, j int) bool {
+		return mismatches[i].ComponentID < mismatches[j].ComponentID
+	})
+	return mismatches
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+// Kinds of canonical circuit forms
+const (
+	formComponent = 'C'
+	formSeries    = 'S'
+	formParallel  = 'P'
+)
+
+// circuitForm is the canonical form of a sub-circuit seen from its first
+// node to its second. Two sub-circuits with the same label are electrically
+// interchangeable, and their parts line up position by position.
+type circuitForm struct {
+	Kind  byte
+	Label string
+	// RevLabel is the label of a component seen from its second pin to its first
+	RevLabel string
+	// Parts lists the component IDs in canonical order
+	Parts    []string
+	Children []circuitForm
+}
+
+// componentForm builds the form of a single component from its parameters,
+// so that parts of the same kind and value share a label
+func componentForm(c circuitComponent) circuitForm {
+	params := c.Component
+	params.ID = ""
+	data, _ := json.Marshal(params)
+
+	form := circuitForm{
+		Kind:     formComponent,
+		Label:    string(data),
+		RevLabel: string(data),
+		Parts:    []string{c.ID},
+	}
+	// Polarised parts look different from each side
+	switch c.Kind {
+	case KindBattery, KindLED, KindBuzzer, KindMotor:
+		form.Label += ">"
+		form.RevLabel += "<"
+	}
+	return form
+}
+
+// combineForms builds a series or parallel form. Nested forms of the same
+// kind are flattened and children are sorted, so the order in which series
+// elements or parallel branches were wired does not matter.
+func combineForms(kind byte, children []circuitForm) circuitForm {
+	var flat []circuitForm
+	for _, child := range children {
+		if child.Kind == kind {
+			flat = append(flat, child.Children...)
+		} else {
+			flat = append(flat, child)
+		}
+	}
+	sort.SliceStable(flat, func(i, j int) bool {
+		return flat[i].Label < flat[j].Label
+	})
+
+	form := circuitForm{Kind: kind, Children: flat}
+	labels := make([]string, len(flat))
+	for i, child := range flat {
+		labels[i] = child.Label
+		form.Parts = append(form.Parts, child.Parts...)
+	}
+	form.Label = string(kind) + "(" + strings.Join(labels, ",") + ")"
+	return form
+}
+
+// reversed returns the form seen from its second node to its first
+func (f circuitForm) reversed() circuitForm {
+	if f.Kind == formComponent {
+		f.Label, f.RevLabel = f.RevLabel, f.Label
+		return f
+	}
+	children := make([]circuitForm, len(f.Children))
+	for i, child := range f.Children {
+		children[i] = child.reversed()
+	}
+	return combineForms(f.Kind, children)
+}
+
+// circuitEdge joins the nodes of a form; components with more than two
+// pins stay as single edges over all their pin nodes
+type circuitEdge struct {
+	Nodes []int
+	Form  circuitForm
+}
+
+// formFrom returns the form of a two-node edge seen from the given node
+func (e circuitEdge) formFrom(node int) circuitForm {
+	if e.Nodes[0] == node {
+		return e.Form
+	}
+	return e.Form.reversed()
+}
+
+// reduceCircuit turns a netlist into edges and repeatedly merges parallel
+// edges and series chains. Battery terminals are never merged away, so the
+// loads are reduced to canonical forms between the battery terminals.
+func reduceCircuit(netlist circuitNetlist) []circuitEdge {
+	var edges []circuitEdge
+	protected := make(map[int]bool)
+	for _, c := range netlist.Components {
+		if c.Kind == KindJunction {
+			continue // junctions are just nodes
+		}
+		if c.Kind == KindBattery {
+			for _, node := range c.Nodes {
+				protected[node] = true
+			}
+		}
+		edges = append(edges, circuitEdge{
+			Nodes: append([]int(nil), c.Nodes...),
+			Form:  componentForm(c),
+		})
+	}
+
+	for changed := true; changed; {
+		edges, changed = reduceParallel(edges)
+		if reduced, ok := reduceSeries(edges, protected); ok {
+			edges = reduced
+			changed = true
+		}
+	}
+
+	return edges
+}
+
+// reduceParallel merges two-node edges that join the same pair of nodes
+func reduceParallel(edges []circuitEdge) ([]circuitEdge, bool) {
+	groups := make(map[[2]int][]circuitEdge)
+	var order [][2]int
+	var result []circuitEdge
+	for _, e := range edges {
+		if len(e.Nodes) != 2 {
+			result = append(result, e)
+			continue
+		}
+		key := [2]int{e.Nodes[0], e.Nodes[1]}
+		if key[0] > key[1] {
+			key[0], key[1] = key[1], key[0]
+		}
+		if _, ok := groups[key]; !ok {
+			order = append(order, key)
+		}
+		groups[key] = append(groups[key], e)
+	}
+
+	changed := false
+	for _, key := range order {
+		group := groups[key]
+		if len(group) == 1 {
+			result = append(result, group[0])
+			continue
+		}
+		forms := make([]circuitForm, len(group))
+		for i, e := range group {
+			forms[i] = e.formFrom(key[0])
+		}
+		result = append(result, circuitEdge{
+			Nodes: []int{key[0], key[1]},
+			Form:  combineForms(formParallel, forms),
+		})
+		changed = true
+	}
+
+	return result, changed
+}
+
+// reduceSeries merges the two edges meeting at the first unprotected node
+// that joins exactly two two-node edges
+func reduceSeries(edges []circuitEdge, protected map[int]bool) ([]circuitEdge, bool) {
+	incident := make(map[int][]int)
+	for i, e := range edges {
+		for _, node := range e.Nodes {
+			incident[node] = append(incident[node], i)
+		}
+	}
+
+	nodes := make([]int, 0, len(incident))
+	for node := range incident {
+		nodes = append(nodes, node)
+	}
+	sort.Ints(nodes)
+
+	for _, node := range nodes {
+		pair := incident[node]
+		if protected[node] || len(pair) != 2 || pair[0] == pair[1] {
+			continue
+		}
+		first, second := edges[pair[0]], edges[pair[1]]
+		if len(first.Nodes) != 2 || len(second.Nodes) != 2 {
+			continue
+		}
+
+		// Walk from the far end of the first edge through the node to the far end of the second
+		start := first.Nodes[0]
+		if start == node {
+			start = first.Nodes[1]
+		}
+		end := second.Nodes[0]
+		if end == node {
+			end = second.Nodes[1]
+		}
+		merged := circuitEdge{
+			Nodes: []int{start, end},
+			Form:  combineForms(formSeries, []circuitForm{first.formFrom(start), second.formFrom(node)}),
+		}
+
+		result := []circuitEdge{merged}
+		for i, e := range edges {
+			if i != pair[0] && i != pair[1] {
+				result = append(result, e)
+			}
+		}
+		return result, true
+	}
+
+	return edges, false
+}
+
+// matchCircuits checks that the submitted circuit is topologically equivalent
+// to the reference one. It returns how each submitted component maps onto a
+// reference component; junctions are wiring points and are not mapped.
+func matchCircuits(submitted, reference circuitNetlist) (map[string]string, bool) {
+	subEdges := reduceCircuit(submitted)
+	refEdges := reduceCircuit(reference)
+	if len(subEdges) != len(refEdges) {
+		return nil, false
+	}
+
+	m := &edgeMatcher{
+		sub:     subEdges,
+		ref:     refEdges,
+		used:    make([]bool, len(refEdges)),
+		forward: make(map[int]int),
+		back:    make(map[int]int),
+		mapping: make(map[string]string),
+	}
+	if !m.match(0) {
+		return nil, false
+	}
+	return m.mapping, true
+}
+
+// edgeMatcher searches for a one-to-one mapping between two sets of reduced
+// edges that also maps their nodes consistently
+type edgeMatcher struct {
+	sub, ref []circuitEdge
+	used     []bool
+	forward  map[int]int // submitted node to reference node
+	back     map[int]int // reference node to submitted node
+	mapping  map[string]string
+}
+
+// match matches the submitted edges from index i onwards
+func (m *edgeMatcher) match(i int) bool {
+	if i == len(m.sub) {
+		return true
+	}
+	edge := m.sub[i]
+
+	for j, candidate := range m.ref {
+		if m.used[j] || len(candidate.Nodes) != len(edge.Nodes) {
+			continue
+		}
+
+		// Two-node edges may be matched in either direction
+		orientations := []circuitEdge{edge}
+		if len(edge.Nodes) == 2 && edge.Nodes[0] != edge.Nodes[1] {
+			orientations = append(orientations, circuitEdge{
+				Nodes: []int{edge.Nodes[1], edge.Nodes[0]},
+				Form:  edge.Form.reversed(),
+			})
+		}
+
+		for _, oriented := range orientations {
+			if oriented.Form.Label != candidate.Form.Label {
+				continue
+			}
+			added, ok := m.bindNodes(oriented.Nodes, candidate.Nodes)
+			if !ok {
+				continue
+			}
+
+			m.used[j] = true
+			if m.match(i + 1) {
+				for k, part := range oriented.Form.Parts {
+					m.mapping[part] = candidate.Form.Parts[k]
+				}
+				return true
+			}
+			m.used[j] = false
+			for _, node := range added {
+				delete(m.back, m.forward[node])
+				delete(m.forward, node)
+			}
+		}
+	}
+
+	return false
+}
+
+// bindNodes maps submitted nodes onto reference nodes, failing on conflicts.
+// It returns the submitted nodes that were newly bound.
+func (m *edgeMatcher) bindNodes(subNodes, refNodes []int) ([]int, bool) {
+	var added []int
+	for k, node := range subNodes {
+		target, bound := m.forward[node]
+		if bound && target == refNodes[k] {
+			continue
+		}
+		if _, taken := m.back[refNodes[k]]; bound || taken {
+			for _, n := range added {
+				delete(m.back, m.forward[n])
+				delete(m.forward, n)
+			}
+			return nil, false
+		}
+		m.forward[node] = refNodes[k]
+		m.back[refNodes[k]] = node
+		added = append(added, node)
+	}
+	return added, true
+}
+
+// renamed returns the operating point with component IDs translated through
+// the mapping; components without a mapping are left out
+func (op circuitOperatingPoint) renamed(mapping map[string]string) circuitOperatingPoint {
+	result := circuitOperatingPoint{
+		Voltages: op.Voltages,
+		Currents: make(map[string]float64),
+		Powered:  make(map[string]bool),
+	}
+	for id, target := range mapping {
+		result.Currents[target] = op.Currents[id]
+		result.Powered[target] = op.Powered[id]
+	}
+	return result
+}
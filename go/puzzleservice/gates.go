@@ -0,0 +1,380 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Limits of gate-network verification
+const (
+	// maxLogicInputs bounds the inputs of a gate puzzle, since every input combination is checked
+	maxLogicInputs = 16
+	// maxFailingRows bounds the number of failing rows listed in a result
+	maxFailingRows = 32
+)
+
+// LogicGate is a gate of a submitted logic circuit
+type LogicGate struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	// Inputs lists the puzzle inputs or gate IDs feeding the gate
+	Inputs []string `json:"inputs"`
+	// Initial is the value a latch or flip-flop stores before the first cycle
+	Initial bool `json:"initial,omitempty"`
+}
+
+// LogicCircuitSpec declares the inputs and outputs of a gate puzzle and
+// what the outputs must compute, either as expressions over the inputs or
+// as a truth table
+type LogicCircuitSpec struct {
+	Inputs []string `json:"inputs"`
+	// Outputs maps each output to the expression it must compute
+	Outputs map[string]string `json:"outputs,omitempty"`
+	// TruthTable lists the expected outputs for input combinations; rows
+	// left out of the table are not checked
+	TruthTable []TruthTableRow `json:"truthTable,omitempty"`
+	// AllowedGates restricts the gate types a submission may use
+	AllowedGates []string `json:"allowedGates,omitempty"`
+}
+
+// TruthTableRow is one row of a truth table
+type TruthTableRow struct {
+	Inputs  map[string]bool `json:"inputs"`
+	Outputs map[string]bool `json:"outputs"`
+}
+
+// FailingRow is an input combination for which a gate network gives the wrong outputs
+type FailingRow struct {
+	Inputs   map[string]bool `json:"inputs"`
+	Expected map[string]bool `json:"expected"`
+	Actual   map[string]bool `json:"actual"`
+}
+
+// gateArity returns the minimum and maximum number of inputs of a gate type,
+// zero meaning no maximum, and whether the type is known
+func gateArity(gateType string) (int, int, bool) {
+	switch gateType {
+	case opNot:
+		return 1, 1, true
+	case opAnd, opOr, opXor, opNand, opNor:
+		return 2, 0, true
+	case gateDFlipFlop, gateTFlipFlop:
+		return 1, 1, true
+	case gateJKFlipFlop, gateSRLatch, gateDLatch:
+		return 2, 2, true
+	}
+	return 0, 0, false
+}
+
+// outputNames returns the outputs of the spec, sorted
+func (spec LogicCircuitSpec) outputNames() []string {
+	seen := make(map[string]bool)
+	for name := range spec.Outputs {
+		seen[name] = true
+	}
+	for _, row := range spec.TruthTable {
+		for name := range row.Outputs {
+			seen[name] = true
+		}
+	}
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// validateLogicCircuit checks that a gate puzzle is well formed
+func validateLogicCircuit(spec *LogicCircuitSpec) error {
+	if spec == nil {
+		return nil
+	}
+	if len(spec.Inputs) > maxLogicInputs {
+		return fmt.Errorf("gate puzzles take at most %d inputs", maxLogicInputs)
+	}
+	if len(spec.outputNames()) == 0 {
+		return fmt.Errorf("gate puzzle declares no outputs")
+	}
+	if len(spec.Outputs) > 0 && len(spec.TruthTable) > 0 {
+		return fmt.Errorf("give the outputs either as expressions or as a truth table")
+	}
+	for name, src := range spec.Outputs {
+		expr, err := ParseBoolExpr(src)
+		if err != nil {
+			return fmt.Errorf("output '%s': %v", name, err)
+		}
+		for _, variable := range expr.Variables() {
+			if !containsString(spec.Inputs, variable) {
+				return fmt.Errorf("output '%s' uses '%s', which is not an input", name, variable)
+			}
+		}
+	}
+	for i, row := range spec.TruthTable {
+		for _, input := range spec.Inputs {
+			if _, ok := row.Inputs[input]; !ok {
+				return fmt.Errorf("truth table row %d has no value for input '%s'", i+1, input)
+			}
+		}
+	}
+	return nil
+}
+
+// gateNetwork evaluates a set of gates
+type gateNetwork struct {
+	gates map[string]LogicGate
+	// state holds the stored value of each latch and flip-flop
+	state map[string]bool
+}
+
+// newGateNetwork checks the gates of a submission and indexes them by ID
+func newGateNetwork(gates []LogicGate, inputs []string) (*gateNetwork, error) {
+	network := &gateNetwork{gates: make(map[string]LogicGate), state: make(map[string]bool)}
+	for _, gate := range gates {
+		gate.Type = strings.ToUpper(gate.Type)
+		if gate.ID == "" {
+			return nil, fmt.Errorf("gate without an ID")
+		}
+		if _, ok := network.gates[gate.ID]; ok || containsString(inputs, gate.ID) {
+			return nil, fmt.Errorf("duplicate gate ID '%s'", gate.ID)
+		}
+		min, max, ok := gateArity(gate.Type)
+		if !ok {
+			return nil, fmt.Errorf("gate '%s' has unknown type '%s'", gate.ID, gate.Type)
+		}
+		if len(gate.Inputs) < min || (max > 0 && len(gate.Inputs) > max) {
+			return nil, fmt.Errorf("gate '%s' (%s) has %d inputs", gate.ID, gate.Type, len(gate.Inputs))
+		}
+		network.gates[gate.ID] = gate
+		if isSequential(gate.Type) {
+			network.state[gate.ID] = gate.Initial
+		}
+	}
+
+	for _, gate := range gates {
+		for _, source := range gate.Inputs {
+			if _, ok := network.gates[source]; !ok && !containsString(inputs, source) {
+				return nil, fmt.Errorf("gate '%s' reads '%s', which is neither an input nor a gate", gate.ID, source)
+			}
+		}
+	}
+
+	// Gates must not feed back into themselves, except through a latch or
+	// flip-flop, whose output is its stored value
+	state := make(map[string]int) // 1 while visiting, 2 once done
+	var visit func(id string) error
+	visit = func(id string) error {
+		gate, ok := network.gates[id]
+		if !ok || state[id] == 2 || isSequential(gate.Type) {
+			return nil
+		}
+		if state[id] == 1 {
+			return fmt.Errorf("gate network has a loop through '%s'", id)
+		}
+		state[id] = 1
+		for _, source := range gate.Inputs {
+			if err := visit(source); err != nil {
+				return err
+			}
+		}
+		state[id] = 2
+		return nil
+	}
+	for _, gate := range gates {
+		for _, source := range gate.Inputs {
+			if err := visit(source); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return network, nil
+}
+
+// signal evaluates an input or gate output for the given input values,
+// caching gate outputs in values. Latches and flip-flops output their
+// stored value.
+func (n *gateNetwork) signal(id string, values map[string]bool) bool {
+	if value, ok := values[id]; ok {
+		return value
+	}
+	if value, ok := n.state[id]; ok {
+		return value
+	}
+	gate := n.gates[id]
+
+	inputs := make([]bool, len(gate.Inputs))
+	for i, source := range gate.Inputs {
+		inputs[i] = n.signal(source, values)
+	}
+
+	var value bool
+	switch gate.Type {
+	case opNot:
+		value = !inputs[0]
+	case opAnd, opNand:
+		value = true
+		for _, in := range inputs {
+			value = value && in
+		}
+		if gate.Type == opNand {
+			value = !value
+		}
+	case opOr, opNor:
+		for _, in := range inputs {
+			value = value || in
+		}
+		if gate.Type == opNor {
+			value = !value
+		}
+	case opXor:
+		for _, in := range inputs {
+			value = value != in
+		}
+	}
+	values[id] = value
+	return value
+}
+
+// inputRows returns every combination of values for the inputs, counting
+// up in binary with the first input as the most significant bit
+func inputRows(inputs []string) []map[string]bool {
+	rows := make([]map[string]bool, 0, 1<<len(inputs))
+	for bits := 0; bits < 1<<len(inputs); bits++ {
+		row := make(map[string]bool, len(inputs))
+		for i, input := range inputs {
+			row[input] = bits&(1<<(len(inputs)-1-i)) != 0
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// expectedOutputs returns the outputs a row must produce and whether the row is checked at all
+func (spec LogicCircuitSpec) expectedOutputs(row map[string]bool, exprs map[string]*boolExpr) (map[string]bool, bool) {
+	if len(exprs) > 0 {
+		expected := make(map[string]bool, len(exprs))
+		for name, expr := range exprs {
+			expected[name] = expr.Eval(row)
+		}
+		return expected, true
+	}
+
+	for _, tableRow := range spec.TruthTable {
+		matches := true
+		for _, input := range spec.Inputs {
+			if tableRow.Inputs[input] != row[input] {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return tableRow.Outputs, true
+		}
+	}
+	return nil, false
+}
+
+// verifyLogicCircuit checks a submitted gate network against every input
+// combination of a gate puzzle
+func verifyLogicCircuit(result PuzzleVerificationResult, spec LogicCircuitSpec, submitted LogicSolution) PuzzleVerificationResult {
+	if len(submitted.Gates) == 0 {
+		result.Message = "Logic circuit has no gates"
+		return result
+	}
+
+	network, err := newGateNetwork(submitted.Gates, spec.Inputs)
+	if err != nil {
+		result.Message = fmt.Sprintf("Invalid logic circuit: %v", err)
+		return result
+	}
+
+	for _, gate := range submitted.Gates {
+		if isSequential(strings.ToUpper(gate.Type)) {
+			result.Message = fmt.Sprintf("Gate '%s' stores state, but this puzzle asks for a combinational circuit", gate.ID)
+			return result
+		}
+	}
+
+	if len(spec.AllowedGates) > 0 {
+		for _, gate := range submitted.Gates {
+			allowed := false
+			for _, gateType := range spec.AllowedGates {
+				allowed = allowed || strings.EqualFold(gateType, gate.Type)
+			}
+			if !allowed {
+				result.Message = fmt.Sprintf("Gate '%s' is of type %s, but only %s gates may be used", gate.ID, strings.ToUpper(gate.Type), strings.Join(spec.AllowedGates, ", "))
+				return result
+			}
+		}
+	}
+
+	outputs := spec.outputNames()
+	for _, name := range outputs {
+		source, ok := submitted.Outputs[name]
+		if !ok {
+			result.Message = fmt.Sprintf("Output '%s' is not connected", name)
+			return result
+		}
+		if _, ok := network.gates[source]; !ok && !containsString(spec.Inputs, source) {
+			result.Message = fmt.Sprintf("Output '%s' reads '%s', which is neither an input nor a gate", name, source)
+			return result
+		}
+	}
+
+	for name := range submitted.Outputs {
+		if !containsString(outputs, name) {
+			result.Message = fmt.Sprintf("'%s' is not an output of this puzzle", name)
+			return result
+		}
+	}
+
+	exprs := make(map[string]*boolExpr)
+	for name, src := range spec.Outputs {
+		expr, err := ParseBoolExpr(src)
+		if err != nil {
+			result.Message = fmt.Sprintf("Failed to parse output expression: %v", err)
+			return result
+		}
+		exprs[name] = expr
+	}
+
+	checked, failed := 0, 0
+	for _, row := range inputRows(spec.Inputs) {
+		expected, ok := spec.expectedOutputs(row, exprs)
+		if !ok {
+			continue
+		}
+		checked++
+
+		values := make(map[string]bool, len(row))
+		for input, value := range row {
+			values[input] = value
+		}
+		actual := make(map[string]bool, len(outputs))
+		wrong := false
+		for _, name := range outputs {
+			actual[name] = network.signal(submitted.Outputs[name], values)
+			if want, ok := expected[name]; ok && want != actual[name] {
+				wrong = true
+			}
+		}
+
+		if wrong {
+			failed++
+			if len(result.FailingRows) < maxFailingRows {
+				result.FailingRows = append(result.FailingRows, FailingRow{Inputs: row, Expected: expected, Actual: actual})
+			}
+		}
+	}
+
+	if failed > 0 {
+		result.Message = fmt.Sprintf("Logic circuit gives wrong outputs for %d of %d input rows", failed, checked)
+		return result
+	}
+
+	result.Valid = true
+	result.Message = "Logic circuit is correct"
+	return result
+}
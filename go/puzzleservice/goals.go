@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CircuitScenario is a goal of a circuit puzzle: with the switches set as
+// listed, the listed components must be powered as expected
+type CircuitScenario struct {
+	Name string `json:"name,omitempty"`
+	// Switches maps switch IDs to whether they are closed
+	Switches map[string]bool `json:"switches"`
+	Expected []PowerState    `json:"expected"`
+}
+
+// ScenarioResult represents the outcome of simulating one goal scenario
+type ScenarioResult struct {
+	Name       string       `json:"name"`
+	Passed     bool         `json:"passed"`
+	Message    string       `json:"message,omitempty"`
+	PowerState []PowerState `json:"powerState,omitempty"`
+}
+
+// withSwitches returns a copy of the netlist with the given switches opened or closed
+func (n circuitNetlist) withSwitches(switches map[string]bool) circuitNetlist {
+	components := make([]circuitComponent, len(n.Components))
+	copy(components, n.Components)
+	for i, c := range components {
+		if closed, ok := switches[c.ID]; ok && c.Kind == KindSwitch {
+			components[i].Closed = boolPtr(closed)
+		}
+	}
+	n.Components = components
+	return n
+}
+
+// scenarioName returns the name of a scenario, numbering it if it has none
+func scenarioName(index int, scenario CircuitScenario) string {
+	if scenario.Name != "" {
+		return scenario.Name
+	}
+	return fmt.Sprintf("scenario %d", index+1)
+}
+
+// runScenario simulates the netlist with the scenario's switch states and
+// checks the expected power states
+func runScenario(netlist circuitNetlist, index int, scenario CircuitScenario) (ScenarioResult, []CircuitHazard) {
+	result := ScenarioResult{Name: scenarioName(index, scenario)}
+
+	for id := range scenario.Switches {
+		if c, ok := netlist.component(id); !ok || c.Kind != KindSwitch {
+			result.Message = fmt.Sprintf("Switch '%s' is not in the circuit", id)
+			return result, nil
+		}
+	}
+
+	scenarioNetlist := netlist.withSwitches(scenario.Switches)
+	op, err := simulateNetlist(scenarioNetlist)
+	if err != nil {
+		result.Message = fmt.Sprintf("Failed to simulate circuit: %v", err)
+		return result, nil
+	}
+	result.PowerState = op.PowerStates()
+
+	var wrong []string
+	for _, expected := range scenario.Expected {
+		if op.Powered[expected.ComponentID] != expected.Powered {
+			state := "off"
+			if expected.Powered {
+				state = "on"
+			}
+			wrong = append(wrong, fmt.Sprintf("'%s' should be %s", expected.ComponentID, state))
+		}
+	}
+	if len(wrong) > 0 {
+		result.Message = strings.Join(wrong, ", ")
+		return result, detectHazards(scenarioNetlist, op)
+	}
+
+	result.Passed = true
+	return result, detectHazards(scenarioNetlist, op)
+}
+
+// verifyCircuitGoals checks a submitted circuit against every goal scenario,
+// accepting any wiring that meets them all
+func verifyCircuitGoals(result PuzzleVerificationResult, goals []CircuitScenario, netlist circuitNetlist) PuzzleVerificationResult {
+	failed := 0
+	for i, scenario := range goals {
+		scenarioResult, hazards := runScenario(netlist, i, scenario)
+		result.Scenarios = append(result.Scenarios, scenarioResult)
+		if !scenarioResult.Passed {
+			failed++
+		}
+
+		// A switch setting can expose hazards the default setting hides
+		result.Hazards = mergeHazards(result.Hazards, hazards)
+	}
+
+	if len(result.Hazards) > 0 {
+		result.Message = fmt.Sprintf("Circuit is unsafe: %s", result.Hazards[0].Message)
+		return result
+	}
+
+	if failed > 0 {
+		result.Message = fmt.Sprintf("Circuit fails %d of %d scenarios", failed, len(goals))
+		return result
+	}
+
+	result.Valid = true
+	result.Message = "Circuit meets all goals"
+	return result
+}
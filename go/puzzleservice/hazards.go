@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// HazardKind identifies a dangerous condition in a circuit
+type HazardKind string
+
+const (
+	HazardShortCircuit HazardKind = "short_circuit"
+	HazardOvercurrent  HazardKind = "overcurrent"
+	HazardOverpower    HazardKind = "overpower"
+	HazardReverseBias  HazardKind = "reverse_bias"
+	HazardBurnout      HazardKind = "burnout"
+)
+
+// shortCircuitRatio is the fraction of its voltage below which a battery's
+// terminal voltage counts as shorted
+const shortCircuitRatio = 0.5
+
+// CircuitHazard describes a dangerous condition found while simulating a circuit
+type CircuitHazard struct {
+	Kind        HazardKind `json:"kind"`
+	ComponentID string     `json:"componentId"`
+	// Value is the measured current (A), power (W) or voltage (V)
+	Value float64 `json:"value"`
+	// Limit is the rating the value was checked against, in the same unit
+	Limit   float64 `json:"limit"`
+	Message string  `json:"message"`
+}
+
+// detectHazards finds shorted batteries, components running above their
+// current or power rating, and LEDs that are reverse-biased or burnt out
+func detectHazards(netlist circuitNetlist, op circuitOperatingPoint) []CircuitHazard {
+	var hazards []CircuitHazard
+	for _, c := range netlist.Components {
+		current := math.Abs(op.Currents[c.ID])
+
+		switch c.Kind {
+		case KindBattery:
+			// The terminal voltage collapses when the battery is shorted
+			terminal := -op.drop(c)
+			if terminal < shortCircuitRatio*c.Voltage {
+				hazards = append(hazards, CircuitHazard{
+					Kind:        HazardShortCircuit,
+					ComponentID: c.ID,
+					Value:       current,
+					Limit:       c.Voltage / c.InternalResistance,
+					Message:     fmt.Sprintf("Battery '%s' is short-circuited, drawing %.2f A", c.ID, current),
+				})
+			}
+		case KindResistor:
+			power := current * current * c.Resistance
+			if c.MaxPower > 0 && power > c.MaxPower {
+				hazards = append(hazards, CircuitHazard{
+					Kind:        HazardOverpower,
+					ComponentID: c.ID,
+					Value:       power,
+					Limit:       c.MaxPower,
+					Message:     fmt.Sprintf("Resistor '%s' dissipates %.2f W, above its %.2f W rating", c.ID, power, c.MaxPower),
+				})
+			}
+		case KindLED:
+			if current > c.MaxCurrent {
+				hazards = append(hazards, CircuitHazard{
+					Kind:        HazardBurnout,
+					ComponentID: c.ID,
+					Value:       current,
+					Limit:       c.MaxCurrent,
+					Message:     fmt.Sprintf("LED '%s' burns out at %.1f mA, above its %.1f mA rating; add a current-limiting resistor", c.ID, current*1000, c.MaxCurrent*1000),
+				})
+			}
+			if reverse := -op.drop(c); reverse > c.MaxReverseVoltage {
+				hazards = append(hazards, CircuitHazard{
+					Kind:        HazardReverseBias,
+					ComponentID: c.ID,
+					Value:       reverse,
+					Limit:       c.MaxReverseVoltage,
+					Message:     fmt.Sprintf("LED '%s' is reverse-biased at %.1f V, above its %.1f V rating", c.ID, reverse, c.MaxReverseVoltage),
+				})
+			}
+		case KindBuzzer, KindMotor, KindTransistor:
+			if c.MaxCurrent > 0 && current > c.MaxCurrent {
+				hazards = append(hazards, CircuitHazard{
+					Kind:        HazardOvercurrent,
+					ComponentID: c.ID,
+					Value:       current,
+					Limit:       c.MaxCurrent,
+					Message:     fmt.Sprintf("Component '%s' carries %.1f mA, above its %.1f mA rating", c.ID, current*1000, c.MaxCurrent*1000),
+				})
+			}
+		}
+	}
+	return hazards
+}
+
+// mergeHazards adds the found hazards that are not listed yet, keeping one
+// hazard of each kind per component
+func mergeHazards(hazards, found []CircuitHazard) []CircuitHazard {
+	for _, hazard := range found {
+		listed := false
+		for _, existing := range hazards {
+			if existing.Kind == hazard.Kind && existing.ComponentID == hazard.ComponentID {
+				listed = true
+				break
+			}
+		}
+		if !listed {
+			hazards = append(hazards, hazard)
+		}
+	}
+	return hazards
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Boolean operators, from the loosest binding to the tightest:
+// IMPLIES, OR and NOR, XOR, AND and NAND, NOT
+const (
+	opVariable = "VAR"
+	opConstant = "CONST"
+	opNot      = "NOT"
+	opAnd      = "AND"
+	opNand     = "NAND"
+	opOr       = "OR"
+	opNor      = "NOR"
+	opXor      = "XOR"
+	opImplies  = "IMPLIES"
+)
+
+// boolExpr is a node of a parsed boolean expression
+type boolExpr struct {
+	Op       string
+	Name     string
+	Value    bool
+	Operands []*boolExpr
+	// Text is the source text of the sub-expression
+	Text string
+}
+
+// exprToken is a token of a boolean expression with its position in the source
+type exprToken struct {
+	Text       string
+	Start, End int
+}
+
+// tokenizeExpr splits an expression into parentheses, operators and names
+func tokenizeExpr(src string) ([]exprToken, error) {
+	var tokens []exprToken
+	for i := 0; i < len(src); {
+		r := rune(src[i])
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(' || r == ')':
+			tokens = append(tokens, exprToken{Text: string(r), Start: i, End: i + 1})
+			i++
+		case r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r):
+			start := i
+			for i < len(src) && (src[i] == '_' || unicode.IsLetter(rune(src[i])) || unicode.IsDigit(rune(src[i]))) {
+				i++
+			}
+			tokens = append(tokens, exprToken{Text: src[start:i], Start: start, End: i})
+		default:
+			return nil, fmt.Errorf("unexpected character '%c' at position %d", r, i+1)
+		}
+	}
+	return tokens, nil
+}
+
+// exprParser is a recursive-descent parser for boolean expressions
+type exprParser struct {
+	src    string
+	tokens []exprToken
+	pos    int
+}
+
+// ParseBoolExpr parses a boolean expression such as "(A OR B) AND NOT C".
+// Operators are AND, OR, NOT, XOR, NAND, NOR and IMPLIES in any case, and
+// TRUE and FALSE are constants; any other name is a variable.
+func ParseBoolExpr(src string) (*boolExpr, error) {
+	tokens, err := tokenizeExpr(src)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("expression is empty")
+	}
+
+	p := &exprParser{src: src, tokens: tokens}
+	expr, err := p.parseImplies()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected '%s' at position %d", p.tokens[p.pos].Text, p.tokens[p.pos].Start+1)
+	}
+	return expr, nil
+}
+
+// peek returns the upper-cased text of the next token, or "" at the end
+func (p *exprParser) peek() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	return strings.ToUpper(p.tokens[p.pos].Text)
+}
+
+// binary builds a binary operator node spanning both operands
+func (p *exprParser) binary(op string, left, right *boolExpr, start, end int) *boolExpr {
+	return &boolExpr{
+		Op:       op,
+		Operands: []*boolExpr{left, right},
+		Text:     strings.TrimSpace(p.src[start:end]),
+	}
+}
+
+// end returns the source offset just past the last consumed token
+func (p *exprParser) end() int {
+	return p.tokens[p.pos-1].End
+}
+
+// parseImplies parses a right-associative chain of implications
+func (p *exprParser) parseImplies() (*boolExpr, error) {
+	start := p.pos
+	left, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek() != opImplies {
+		return left, nil
+	}
+	p.pos++
+	right, err := p.parseImplies()
+	if err != nil {
+		return nil, err
+	}
+	return p.binary(opImplies, left, right, p.tokens[start].Start, p.end()), nil
+}
+
+// parseOr parses a left-associative chain of OR and NOR
+func (p *exprParser) parseOr() (*boolExpr, error) {
+	start := p.pos
+	left, err := p.parseXor()
+	if err != nil {
+		return nil, err
+	}
+	for op := p.peek(); op == opOr || op == opNor; op = p.peek() {
+		p.pos++
+		right, err := p.parseXor()
+		if err != nil {
+			return nil, err
+		}
+		left = p.binary(op, left, right, p.tokens[start].Start, p.end())
+	}
+	return left, nil
+}
+
+// parseXor parses a left-associative chain of XOR
+func (p *exprParser) parseXor() (*boolExpr, error) {
+	start := p.pos
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == opXor {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = p.binary(opXor, left, right, p.tokens[start].Start, p.end())
+	}
+	return left, nil
+}
+
+// parseAnd parses a left-associative chain of AND and NAND
+func (p *exprParser) parseAnd() (*boolExpr, error) {
+	start := p.pos
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for op := p.peek(); op == opAnd || op == opNand; op = p.peek() {
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = p.binary(op, left, right, p.tokens[start].Start, p.end())
+	}
+	return left, nil
+}
+
+// parseUnary parses NOT, a parenthesised expression, a constant or a variable
+func (p *exprParser) parseUnary() (*boolExpr, error) {
+	if p.pos >= len(p.tokens) {
+		return nil, fmt.Errorf("expression ends unexpectedly")
+	}
+	token := p.tokens[p.pos]
+
+	switch word := strings.ToUpper(token.Text); word {
+	case opNot:
+		p.pos++
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &boolExpr{Op: opNot, Operands: []*boolExpr{operand}, Text: p.src[token.Start:p.end()]}, nil
+	case "(":
+		p.pos++
+		inner, err := p.parseImplies()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, fmt.Errorf("missing ')' for '(' at position %d", token.Start+1)
+		}
+		p.pos++
+		// Keep the parentheses in the text so clauses read as written
+		inner.Text = p.src[token.Start:p.end()]
+		return inner, nil
+	case ")", opAnd, opNand, opOr, opNor, opXor, opImplies:
+		return nil, fmt.Errorf("unexpected '%s' at position %d", token.Text, token.Start+1)
+	case "TRUE", "FALSE":
+		p.pos++
+		return &boolExpr{Op: opConstant, Value: word == "TRUE", Text: token.Text}, nil
+	}
+
+	p.pos++
+	return &boolExpr{Op: opVariable, Name: token.Text, Text: token.Text}, nil
+}
+
+// Eval evaluates the expression for an assignment of its variables
+func (e *boolExpr) Eval(values map[string]bool) bool {
+	switch e.Op {
+	case opVariable:
+		return values[e.Name]
+	case opConstant:
+		return e.Value
+	case opNot:
+		return !e.Operands[0].Eval(values)
+	}
+
+	left, right := e.Operands[0].Eval(values), e.Operands[1].Eval(values)
+	switch e.Op {
+	case opAnd:
+		return left && right
+	case opNand:
+		return !(left && right)
+	case opOr:
+		return left || right
+	case opNor:
+		return !(left || right)
+	case opXor:
+		return left != right
+	case opImplies:
+		return !left || right
+	}
+	return false
+}
+
+// Variables returns the names of the variables in the expression, sorted
+func (e *boolExpr) Variables() []string {
+	seen := make(map[string]bool)
+	var walk func(*boolExpr)
+	walk = func(node *boolExpr) {
+		if node.Op == opVariable {
+			seen[node.Name] = true
+		}
+		for _, operand := range node.Operands {
+			walk(operand)
+		}
+	}
+	walk(e)
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// failedClause finds the clause that makes a false expression false. It
+// follows AND chains down to the first false conjunct, since every conjunct
+// must hold; any other false clause is reported as a whole.
+func (e *boolExpr) failedClause(values map[string]bool) *boolExpr {
+	if e.Op == opAnd {
+		for _, operand := range e.Operands {
+			if !operand.Eval(values) {
+				return operand.failedClause(values)
+			}
+		}
+	}
+	return e
+}
+
+// clauseText returns the text of a clause without its outer parentheses
+func (e *boolExpr) clauseText() string {
+	text := e.Text
+	for strings.HasPrefix(text, "(") && strings.HasSuffix(text, ")") && balancedInside(text[1:len(text)-1]) {
+		text = strings.TrimSpace(text[1 : len(text)-1])
+	}
+	return text
+}
+
+// balancedInside tells whether the parentheses of s balance without ever closing more than were opened
+func balancedInside(s string) bool {
+	depth := 0
+	for _, r := range s {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth < 0 {
+				return false
+			}
+		}
+	}
+	return depth == 0
+}
+
+// verifyLogicExpression checks that the submitted values assign every
+// variable of the expression and make it true
+func verifyLogicExpression(result PuzzleVerificationResult, expr *boolExpr, values map[string]bool) PuzzleVerificationResult {
+	variables := expr.Variables()
+	for _, name := range variables {
+		if _, ok := values[name]; !ok {
+			result.Message = fmt.Sprintf("Logic value for '%s' is missing", name)
+			return result
+		}
+	}
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !containsString(variables, name) {
+			result.Message = fmt.Sprintf("'%s' is not a variable of this puzzle", name)
+			return result
+		}
+	}
+
+	if !expr.Eval(values) {
+		clause := expr.failedClause(values).clauseText()
+		result.FailedClause = clause
+		result.Message = fmt.Sprintf("Clause '%s' is false", clause)
+		return result
+	}
+
+	result.Valid = true
+	result.Message = "Logic solution is correct"
+	return result
+}
@@ -4,11 +4,11 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 )
 
@@ -20,6 +20,10 @@ const (
 	TypeLogic   PuzzleType = "logic"
 	TypeMaze    PuzzleType = "maze"
 	TypePattern PuzzleType = "pattern"
+	// TypeConstraint puzzles assign values from finite domains to variables
+	TypeConstraint PuzzleType = "constraint"
+	// TypeRover puzzles ask for a program that drives a rover through a maze
+	TypeRover PuzzleType = "rover"
 )
 
 // PuzzleSolution represents a solution submission for a puzzle
@@ -31,9 +35,40 @@ type PuzzleSolution struct {
 
 // PuzzleVerificationResult represents the result of verifying a puzzle solution
 type PuzzleVerificationResult struct {
-	PuzzleID string `json:"puzzleId"`
-	Valid    bool   `json:"valid"`
-	Message  string `json:"message,omitempty"`
+	PuzzleID   string       `json:"puzzleId"`
+	Valid      bool         `json:"valid"`
+	Message    string       `json:"message,omitempty"`
+	PowerState []PowerState `json:"powerState,omitempty"`
+	// Mapping shows which reference component each submitted component was matched to
+	Mapping map[string]string `json:"mapping,omitempty"`
+	// Hazards lists shorts, overloaded parts and damaged LEDs found in a circuit
+	Hazards []CircuitHazard `json:"hazards,omitempty"`
+	// Scenarios holds the outcome of each goal scenario of a circuit puzzle
+	Scenarios []ScenarioResult `json:"scenarios,omitempty"`
+	// FailedClause is the clause of a logic puzzle's expression that the submitted values make false
+	FailedClause string `json:"failedClause,omitempty"`
+	// FailingRows lists the input combinations for which a submitted gate network gives wrong outputs
+	FailingRows []FailingRow `json:"failingRows,omitempty"`
+	// Trace lists the inputs and outputs of each simulated cycle of a sequential logic submission
+	Trace []CycleTrace `json:"trace,omitempty"`
+	// FirstDivergentCycle is the first cycle, counting from 1, whose outputs differ from the expected trace
+	FirstDivergentCycle int `json:"firstDivergentCycle,omitempty"`
+	// FirstWrongTerm is the index, counting from 0, of the first wrong or missing term of a pattern
+	FirstWrongTerm *int `json:"firstWrongTerm,omitempty"`
+	// PathScore compares a maze path with the shortest path through the maze
+	PathScore *MazePathScore `json:"pathScore,omitempty"`
+	// Conflict is the first collision between the agents of a multi-agent maze
+	Conflict *AgentConflict `json:"conflict,omitempty"`
+	// Trajectory lists the cells a rover program drove through, from the start
+	Trajectory []Position `json:"trajectory,omitempty"`
+	// Minimization compares a submitted expression with the minimal form of a logic puzzle's function
+	Minimization *MinimizationResult `json:"minimization,omitempty"`
+	// ViolatedConstraints names the constraints of a constraint puzzle that the submitted values break
+	ViolatedConstraints []string `json:"violatedConstraints,omitempty"`
+	// Diagnostics details the wires, parts and power states that make a circuit submission wrong
+	Diagnostics *CircuitDiagnostics `json:"diagnostics,omitempty"`
+	// Waveform holds the sampled node voltages and assertion outcomes of a transient simulation
+	Waveform *TransientResult `json:"waveform,omitempty"`
 }
 
 // CircuitSolution represents a solution for a circuit puzzle
@@ -42,7 +77,8 @@ type CircuitSolution struct {
 	PowerState  []PowerState `json:"powerState"`
 }
 
-// Connection represents a connection between two components in a circuit
+// Connection represents a wire between two components in a circuit.
+// Each end is either a pin ("led1.anode") or a whole component ("led1").
 type Connection struct {
 	From string `json:"from"`
 	To   string `json:"to"`
@@ -57,17 +93,27 @@ type PowerState struct {
 // LogicSolution represents a solution for a logic puzzle
 type LogicSolution struct {
 	Values map[string]bool `json:"values"`
+	// Gates and Outputs describe a gate network, for puzzles that ask for a circuit
+	Gates []LogicGate `json:"gates,omitempty"`
+	// Outputs maps each puzzle output to the input or gate driving it
+	Outputs map[string]string `json:"outputs,omitempty"`
+	// Expression is the submitted formula, for puzzles that ask for a minimal expression
+	Expression string `json:"expression,omitempty"`
 }
 
 // MazeSolution represents a solution for a maze puzzle
 type MazeSolution struct {
 	Path []Position `json:"path"`
+	// Paths holds a timed path for each agent of a multi-agent maze, by agent ID
+	Paths map[string][]Position `json:"paths,omitempty"`
 }
 
 // Position represents a position in a maze
 type Position struct {
 	X int `json:"x"`
 	Y int `json:"y"`
+	// Z is the floor of a layered maze, from 0
+	Z int `json:"z,omitempty"`
 }
 
 // PatternSolution represents a solution for a pattern puzzle
@@ -287,6 +333,38 @@ func abs(x int) int {
 	return x
 }
 
+// submittedSolution reads the solution passed with --json or --file, if any
+func submittedSolution(jsonStr, inputFile string) json.RawMessage {
+	if jsonStr == "" && inputFile == "" {
+		return nil
+	}
+	data := []byte(jsonStr)
+	if inputFile != "" {
+		fileData, err := ioutil.ReadFile(inputFile)
+		if err != nil {
+			log.Fatalf("Failed to read input file: %v", err)
+		}
+		data = fileData
+	}
+	var solution PuzzleSolution
+	if err := json.Unmarshal(data, &solution); err != nil {
+		log.Fatalf("Failed to parse solution JSON: %v", err)
+	}
+	return solution.Solution
+}
+
+// writeOutput writes command output to a file, or to stdout when no file is given
+func writeOutput(path, content string) {
+	if path == "" {
+		fmt.Print(content)
+		return
+	}
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		log.Fatalf("Failed to write output: %v", err)
+	}
+	fmt.Printf("Wrote %s\n", path)
+}
+
 func main() {
 	// Parse command line flags
 	inputFile := flag.String("file", "", "Path to JSON file containing puzzle solution")
@@ -295,13 +373,85 @@ func main() {
 	puzzleID := flag.String("puzzle", "", "Get details for a specific puzzle")
 	configDir := flag.String("config", "", "Path to config directory (default: ~/.jemulator)")
 	exportPuzzle := flag.String("export", "", "Export a puzzle to a JSON file")
+	showCatalog := flag.Bool("catalog", false, "List the circuit component catalog")
+	toSpice := flag.String("to-spice", "", "Print a circuit puzzle's solution (or the submitted one) as a SPICE netlist")
+	fromSpice := flag.String("from-spice", "", "Convert a SPICE netlist file to a circuit puzzle")
+	renderPuzzle := flag.String("render", "", "Render a circuit or maze puzzle's solution (or the submitted one) as an SVG image")
+	checkSat := flag.String("sat", "", "Count and list the assignments that satisfy a logic puzzle's expression, given a puzzle ID or an expression")
+	generateMaze := flag.String("generate-maze", "", "Generate a maze puzzle from a seed")
+	mazeSize := flag.String("maze-size", "10x10", "Width and height of a generated maze")
+	mazeDifficulty := flag.String("maze-difficulty", "medium", "Difficulty of a generated maze: easy, medium or hard")
+	showTerms := flag.String("terms", "", "List the terms of a pattern puzzle's rule, up to the last one it asks for")
+	openSession := flag.String("open-session", "", "Open an interactive session exploring a maze puzzle")
+	sessionID := flag.String("session", "", "Show the cells visible in a maze session, or make a --move in it")
+	sessionMove := flag.String("move", "", "Move to make in a maze session: a direction, or a cell x,y or x,y,z")
+	outputFile := flag.String("output", "", "Write --to-spice, --render or --generate-maze output to a file instead of stdout")
 	flag.Parse()
 
+	// Handle component catalog command
+	if *showCatalog {
+		output, err := json.MarshalIndent(ComponentCatalog(), "", "  ")
+		if err != nil {
+			log.Fatalf("Failed to marshal component catalog to JSON: %v", err)
+		}
+		fmt.Println(string(output))
+		return
+	}
+
+	// Handle SPICE import command
+	if *fromSpice != "" {
+		file, err := os.Open(*fromSpice)
+		if err != nil {
+			log.Fatalf("Failed to open netlist: %v", err)
+		}
+		defer file.Close()
+
+		circuit, err := ParseSpice(file)
+		if err != nil {
+			log.Fatalf("Failed to parse netlist: %v", err)
+		}
+		id := strings.TrimSuffix(filepath.Base(*fromSpice), filepath.Ext(*fromSpice))
+		puzzle, err := SpiceToPuzzle(id, circuit)
+		if err != nil {
+			log.Fatalf("Failed to convert netlist: %v", err)
+		}
+		output, err := json.MarshalIndent(puzzle, "", "  ")
+		if err != nil {
+			log.Fatalf("Failed to marshal puzzle to JSON: %v", err)
+		}
+		fmt.Println(string(output))
+		return
+	}
+
+	// Handle maze generation command
+	if *generateMaze != "" {
+		seed, err := strconv.ParseInt(*generateMaze, 10, 64)
+		if err != nil {
+			log.Fatalf("Invalid seed: %v", err)
+		}
+		var width, height int
+		if _, err := fmt.Sscanf(*mazeSize, "%dx%d", &width, &height); err != nil {
+			log.Fatalf("Invalid maze size %q, expected WIDTHxHEIGHT", *mazeSize)
+		}
+		generator := MazeGenerator{Seed: seed, Width: width, Height: height, Difficulty: *mazeDifficulty}
+		puzzle, err := GenerateMazePuzzle(fmt.Sprintf("maze_%d", seed), generator)
+		if err != nil {
+			log.Fatalf("Failed to generate maze: %v", err)
+		}
+		output, err := json.MarshalIndent(puzzle, "", "  ")
+		if err != nil {
+			log.Fatalf("Failed to marshal puzzle to JSON: %v", err)
+		}
+		writeOutput(*outputFile, string(output)+"\n")
+		return
+	}
+
 	// Initialize configuration
 	configPaths := DefaultConfigPaths()
 	if *configDir != "" {
 		configPaths.PuzzlesDir = filepath.Join(*configDir, "puzzles")
 		configPaths.PrivateConfigPath = filepath.Join(*configDir, "config.json")
+		configPaths.SessionsDir = filepath.Join(*configDir, "sessions")
 	}
 
 	// Ensure config directories exist
@@ -322,6 +472,103 @@ func main() {
 		log.Fatalf("Failed to load puzzles: %v", err)
 	}
 
+	// Handle satisfiability check command
+	if *checkSat != "" {
+		source, puzzleID := *checkSat, ""
+		if puzzle, ok := store.GetPuzzle(*checkSat); ok {
+			if puzzle.Expression == "" {
+				log.Fatalf("Puzzle %s has no expression", puzzle.ID)
+			}
+			source, puzzleID = puzzle.Expression, puzzle.ID
+		}
+		expr, err := ParseBoolExpr(source)
+		if err != nil {
+			log.Fatalf("Failed to parse expression: %v", err)
+		}
+		report, err := CheckSatisfiability(expr)
+		if err != nil {
+			log.Fatalf("Failed to check expression: %v", err)
+		}
+		report.PuzzleID = puzzleID
+		output, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			log.Fatalf("Failed to marshal report to JSON: %v", err)
+		}
+		fmt.Println(string(output))
+		return
+	}
+
+	// Handle pattern terms command
+	if *showTerms != "" {
+		puzzle, ok := store.GetPuzzle(*showTerms)
+		if !ok {
+			log.Fatalf("Puzzle not found: %s", *showTerms)
+		}
+		if puzzle.Pattern == nil {
+			log.Fatalf("Puzzle %s has no pattern rule", puzzle.ID)
+		}
+		spec := puzzle.Pattern
+		terms, err := PatternTerms(spec.Rule, spec.Offset+spec.Count)
+		if err != nil {
+			log.Fatalf("Failed to generate terms: %v", err)
+		}
+		output, err := json.MarshalIndent(map[string]interface{}{
+			"puzzleId": puzzle.ID,
+			"offset":   spec.Offset,
+			"given":    terms[:spec.Offset],
+			"terms":    terms[spec.Offset:],
+		}, "", "  ")
+		if err != nil {
+			log.Fatalf("Failed to marshal terms to JSON: %v", err)
+		}
+		fmt.Println(string(output))
+		return
+	}
+
+	// Handle maze session commands
+	if *openSession != "" || *sessionID != "" {
+		var session *MazeSession
+		var err error
+		if *openSession != "" {
+			puzzle, ok := store.GetPuzzle(*openSession)
+			if !ok {
+				log.Fatalf("Puzzle not found: %s", *openSession)
+			}
+			session, err = OpenMazeSession(puzzle)
+		} else {
+			session, err = LoadMazeSession(configPaths.SessionsDir, *sessionID)
+		}
+		if err != nil {
+			log.Fatalf("Failed to open session: %v", err)
+		}
+		puzzle, ok := store.GetPuzzle(session.PuzzleID)
+		if !ok || puzzle.Maze == nil {
+			log.Fatalf("Puzzle not found: %s", session.PuzzleID)
+		}
+
+		var view MazeSessionView
+		switch {
+		case *sessionMove != "" && *openSession == "":
+			view, err = session.Move(puzzle, *sessionMove)
+			if err != nil {
+				log.Fatalf("Failed to move: %v", err)
+			}
+		case *openSession != "":
+			view = session.View(puzzle, fmt.Sprintf("Session opened at %v", session.Position))
+		default:
+			view = session.View(puzzle, fmt.Sprintf("Player is at %v after %d moves", session.Position, session.Moves))
+		}
+		if err := session.Save(configPaths.SessionsDir); err != nil {
+			log.Fatalf("Failed to save session: %v", err)
+		}
+		output, err := json.MarshalIndent(view, "", "  ")
+		if err != nil {
+			log.Fatalf("Failed to marshal session to JSON: %v", err)
+		}
+		fmt.Println(string(output))
+		return
+	}
+
 	// Handle list puzzles command
 	if *listPuzzles {
 		puzzles := store.GetAllPuzzles()
@@ -358,6 +605,57 @@ func main() {
 			"description": puzzle.Description,
 			"difficulty":  puzzle.Difficulty,
 		}
+		if len(puzzle.Components) > 0 {
+			puzzleOutput["components"] = puzzle.Components
+		}
+		if len(puzzle.Goals) > 0 {
+			puzzleOutput["goals"] = puzzle.Goals
+		}
+		if puzzle.Transient != nil {
+			puzzleOutput["transient"] = puzzle.Transient
+		}
+		if puzzle.Expression != "" {
+			puzzleOutput["expression"] = puzzle.Expression
+		}
+		if puzzle.UniqueSolution {
+			puzzleOutput["uniqueSolution"] = true
+		}
+		if puzzle.LogicCircuit != nil {
+			puzzleOutput["logicCircuit"] = puzzle.LogicCircuit
+		}
+		if puzzle.Sequential != nil {
+			puzzleOutput["sequential"] = puzzle.Sequential
+		}
+		// Fog keeps the maze hidden, to be explored in a session
+		if puzzle.Maze != nil && puzzle.Fog == nil {
+			puzzleOutput["maze"] = puzzle.Maze
+		}
+		if puzzle.Fog != nil {
+			puzzleOutput["fog"] = puzzle.Fog
+		}
+		// The generator rebuilds the maze, so fog hides it too
+		if puzzle.Generator != nil && puzzle.Fog == nil {
+			puzzleOutput["generator"] = puzzle.Generator
+		}
+		if puzzle.MaxExtraSteps != nil {
+			puzzleOutput["maxExtraSteps"] = *puzzle.MaxExtraSteps
+		}
+		if puzzle.Rover != nil {
+			puzzleOutput["rover"] = puzzle.Rover
+		}
+		if puzzle.Minimize != nil {
+			puzzleOutput["minimize"] = puzzle.Minimize
+		}
+		// Show which terms a rule-based pattern asks for, but not the rule
+		if puzzle.Pattern != nil {
+			puzzleOutput["pattern"] = map[string]int{"offset": puzzle.Pattern.Offset, "count": puzzle.Pattern.Count}
+		}
+		if len(puzzle.Variables) > 0 {
+			puzzleOutput["variables"] = puzzle.Variables
+		}
+		if len(puzzle.Constraints) > 0 {
+			puzzleOutput["constraints"] = puzzle.Constraints
+		}
 		output, err := json.MarshalIndent(puzzleOutput, "", "  ")
 		if err != nil {
 			log.Fatalf("Failed to marshal puzzle to JSON: %v", err)
@@ -391,6 +689,42 @@ func main() {
 		return
 	}
 
+	// Handle SPICE export command
+	if *toSpice != "" {
+		puzzle, ok := store.GetPuzzle(*toSpice)
+		if !ok {
+			log.Fatalf("Puzzle not found: %s", *toSpice)
+		}
+
+		// Export a submitted solution when one is given, otherwise the stored one
+		netlist, err := PuzzleToSpice(puzzle, submittedSolution(*jsonStr, *inputFile))
+		if err != nil {
+			log.Fatalf("Failed to export netlist: %v", err)
+		}
+		writeOutput(*outputFile, netlist)
+		return
+	}
+
+	// Handle render command
+	if *renderPuzzle != "" {
+		puzzle, ok := store.GetPuzzle(*renderPuzzle)
+		if !ok {
+			log.Fatalf("Puzzle not found: %s", *renderPuzzle)
+		}
+
+		// Render a submitted solution against the stored one when one is given
+		render := RenderCircuitSVG
+		if puzzle.Type == TypeMaze || puzzle.Type == TypeRover {
+			render = RenderMazeSVG
+		}
+		svg, err := render(puzzle, submittedSolution(*jsonStr, *inputFile))
+		if err != nil {
+			log.Fatalf("Failed to render puzzle: %v", err)
+		}
+		writeOutput(*outputFile, svg)
+		return
+	}
+
 	// Handle verify solution command
 	var solution PuzzleSolution
 	
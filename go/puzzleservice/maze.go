@@ -0,0 +1,265 @@
+package main
+
+import (
+	"fmt"
+)
+
+// Cells of a maze drawn as rows of text
+const (
+	mazeOpen    = '.'
+	mazeBlocked = '#'
+	mazeStart   = 'S'
+	mazeGoal    = 'G'
+)
+
+// MazeGrid is the layout of a maze puzzle. X counts columns from the left,
+// Y rows from the top and Z floors from the ground, all from 0.
+type MazeGrid struct {
+	// Topology decides which cells are neighbours: "square4" (the default),
+	// "square8", "hex" or "layered"
+	Topology string `json:"topology,omitempty"`
+	Width    int    `json:"width,omitempty"`
+	Height   int    `json:"height,omitempty"`
+	// Depth is the number of floors of a layered maze
+	Depth int      `json:"depth,omitempty"`
+	Start Position `json:"start"`
+	Goal  Position `json:"goal"`
+	// Blocked lists the cells a path may not enter
+	Blocked []Position `json:"blocked,omitempty"`
+	// Walls lists the sides between neighbouring cells a path may not cross
+	Walls []MazeWall `json:"walls,omitempty"`
+	// Rows draws the grid as text instead, one string per row: '#' is
+	// blocked, 'S' the start, 'G' the goal and '.' open
+	Rows []string `json:"rows,omitempty"`
+	// Floors draws each floor of a layered maze as rows, from the ground up
+	Floors [][]string `json:"floors,omitempty"`
+	// Links are the stairs and elevators between the floors of a layered maze
+	Links []MazeLink `json:"links,omitempty"`
+	// Keys, Doors, OneWay, Teleporters and Terrain add mechanics that a
+	// path goes through in order
+	Keys        []MazeKey        `json:"keys,omitempty"`
+	Doors       []MazeDoor       `json:"doors,omitempty"`
+	OneWay      []MazeOneWay     `json:"oneWay,omitempty"`
+	Teleporters []MazeTeleporter `json:"teleporters,omitempty"`
+	Terrain     []MazeTerrain    `json:"terrain,omitempty"`
+	// Agents makes the maze a coordination puzzle for several robots, each
+	// with its own start and goal, instead of a single Start and Goal
+	Agents []MazeAgent `json:"agents,omitempty"`
+}
+
+// MazeWall separates two neighbouring cells
+type MazeWall struct {
+	From Position `json:"from"`
+	To   Position `json:"to"`
+}
+
+// contains tells whether a position lies inside the grid
+func (g *MazeGrid) contains(p Position) bool {
+	return p.X >= 0 && p.Y >= 0 && p.Z >= 0 && p.X < g.Width && p.Y < g.Height && p.Z < g.floors()
+}
+
+// isBlocked tells whether a cell is blocked
+func (g *MazeGrid) isBlocked(p Position) bool {
+	for _, cell := range g.Blocked {
+		if cell == p {
+			return true
+		}
+	}
+	return false
+}
+
+// hasWall tells whether a wall separates two cells
+func (g *MazeGrid) hasWall(a, b Position) bool {
+	for _, wall := range g.Walls {
+		if (wall.From == a && wall.To == b) || (wall.From == b && wall.To == a) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseRows fills the dimensions, start, goal and blocked cells from the
+// rows or floors drawn as text
+func (g *MazeGrid) parseRows() error {
+	floors := g.Floors
+	if len(g.Rows) > 0 {
+		if len(floors) > 0 {
+			return fmt.Errorf("give the grid either as rows or as floors")
+		}
+		floors = [][]string{g.Rows}
+	}
+	if len(floors) == 0 {
+		return nil
+	}
+	if g.Width != 0 || g.Height != 0 || g.Depth != 0 || len(g.Blocked) > 0 {
+		return fmt.Errorf("give the grid either as rows or as dimensions and blocked cells")
+	}
+	if len(floors[0]) == 0 {
+		return fmt.Errorf("floor 0 has no rows")
+	}
+
+	g.Height, g.Width = len(floors[0]), len(floors[0][0])
+	if len(g.Floors) > 0 {
+		g.Depth = len(floors)
+	}
+	starts, goals := 0, 0
+	for z, rows := range floors {
+		if len(rows) != g.Height {
+			return fmt.Errorf("floor %d has %d rows, expected %d", z, len(rows), g.Height)
+		}
+		for y, row := range rows {
+			if len(row) != g.Width {
+				return fmt.Errorf("row %d is %d cells wide, expected %d", y, len(row), g.Width)
+			}
+			for x, cell := range row {
+				p := Position{X: x, Y: y, Z: z}
+				switch cell {
+				case mazeOpen, ' ':
+				case mazeBlocked:
+					g.Blocked = append(g.Blocked, p)
+				case mazeStart:
+					g.Start = p
+					starts++
+				case mazeGoal:
+					g.Goal = p
+					goals++
+				default:
+					return fmt.Errorf("unknown cell '%c' at %v", cell, p)
+				}
+			}
+		}
+	}
+	switch {
+	case len(g.Agents) > 0 && (starts > 0 || goals > 0):
+		return fmt.Errorf("mazes with agents give the starts and goals of the agents instead of marking them")
+	case len(g.Agents) == 0 && (starts != 1 || goals != 1):
+		return fmt.Errorf("rows must mark exactly one start 'S' and one goal 'G'")
+	}
+	return nil
+}
+
+// MazePathScore compares the length of a submitted path with the cheapest path through the maze
+type MazePathScore struct {
+	// Steps counts the moves of the path; teleports are not counted
+	Steps        int `json:"steps"`
+	OptimalSteps int `json:"optimalSteps"`
+	// Cost and OptimalCost add up the cost of the cells entered, for mazes with terrain
+	Cost        int `json:"cost,omitempty"`
+	OptimalCost int `json:"optimalCost,omitempty"`
+	// ExtraSteps is how much more the path costs than the cheapest one,
+	// which on plain floor is the number of extra steps
+	ExtraSteps int `json:"extraSteps"`
+	// RevisitedCells lists the cells the path enters more than once
+	RevisitedCells []Position `json:"revisitedCells,omitempty"`
+}
+
+// validateMaze checks that a maze grid is well formed and solvable
+func validateMaze(grid *MazeGrid) error {
+	if grid == nil {
+		return nil
+	}
+	if err := grid.parseRows(); err != nil {
+		return err
+	}
+	if grid.Width <= 0 || grid.Height <= 0 || grid.Depth < 0 {
+		return fmt.Errorf("maze must be at least one cell wide and high")
+	}
+	if err := validateTopology(grid); err != nil {
+		return err
+	}
+	for _, cell := range grid.Blocked {
+		if !grid.contains(cell) {
+			return fmt.Errorf("blocked cell %v is outside the grid", cell)
+		}
+	}
+	ends := []struct {
+		name string
+		cell Position
+	}{{"start", grid.Start}, {"goal", grid.Goal}}
+	for _, end := range ends {
+		if len(grid.Agents) == 0 && (!grid.contains(end.cell) || grid.isBlocked(end.cell)) {
+			return fmt.Errorf("%s %v must be an open cell of the grid", end.name, end.cell)
+		}
+	}
+	for _, wall := range grid.Walls {
+		if !grid.contains(wall.From) || !grid.isNeighbour(wall.From, wall.To) {
+			return fmt.Errorf("wall between %v and %v does not separate neighbouring cells of the grid", wall.From, wall.To)
+		}
+	}
+	if err := validateMechanics(grid); err != nil {
+		return err
+	}
+	if len(grid.Agents) > 0 {
+		return validateAgents(grid)
+	}
+	if _, ok := grid.cheapestPath(); !ok {
+		return fmt.Errorf("goal %v cannot be reached from the start", grid.Goal)
+	}
+	return nil
+}
+
+// verifyMazePath follows a path from the start to the goal of the grid
+// through the maze's rules and mechanics, and scores it against the
+// cheapest path. When maxExtraSteps is set, the path may cost at most that
+// much more than the cheapest.
+func verifyMazePath(result PuzzleVerificationResult, grid MazeGrid, path []Position, maxExtraSteps *int) PuzzleVerificationResult {
+	if len(path) < 2 {
+		result.Message = "Path is too short"
+		return result
+	}
+	if path[0] != grid.Start {
+		result.Message = fmt.Sprintf("Path must start at %v", grid.Start)
+		return result
+	}
+	if end := path[len(path)-1]; end != grid.Goal {
+		result.Message = fmt.Sprintf("Path must end at %v", grid.Goal)
+		return result
+	}
+
+	walker := newMazeWalker(&grid)
+	for i, next := range path[1:] {
+		if err := walker.move(next); err != nil {
+			result.Message = fmt.Sprintf("Step %d: %v", i+1, err)
+			return result
+		}
+	}
+
+	best, _ := grid.cheapestPath()
+	score := &MazePathScore{Steps: walker.steps, OptimalSteps: best.steps, ExtraSteps: walker.cost - best.cost}
+	if len(grid.Terrain) > 0 {
+		score.Cost, score.OptimalCost = walker.cost, best.cost
+	}
+	visits := make(map[Position]int)
+	for _, cell := range path {
+		visits[cell]++
+		if visits[cell] == 2 {
+			score.RevisitedCells = append(score.RevisitedCells, cell)
+		}
+	}
+	result.PathScore = score
+
+	if maxExtraSteps != nil && score.ExtraSteps > *maxExtraSteps {
+		switch {
+		case len(grid.Terrain) > 0:
+			result.Message = fmt.Sprintf("Path costs %d, but it may cost at most %d more than the cheapest path, which costs %d",
+				score.Cost, *maxExtraSteps, score.OptimalCost)
+		case *maxExtraSteps == 0:
+			result.Message = fmt.Sprintf("Path takes %d steps, but it must be a shortest path of %d steps", score.Steps, score.OptimalSteps)
+		default:
+			result.Message = fmt.Sprintf("Path takes %d steps, but it may take at most %d more than the shortest path of %d steps",
+				score.Steps, *maxExtraSteps, score.OptimalSteps)
+		}
+		return result
+	}
+
+	result.Valid = true
+	switch {
+	case score.ExtraSteps == 0:
+		result.Message = "Maze solution is correct and optimal"
+	case len(grid.Terrain) > 0:
+		result.Message = fmt.Sprintf("Maze solution is correct, costing %d more than the cheapest path", score.ExtraSteps)
+	default:
+		result.Message = fmt.Sprintf("Maze solution is correct, %d steps longer than the shortest path", score.ExtraSteps)
+	}
+	return result
+}
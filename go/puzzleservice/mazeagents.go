@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Kinds of conflicts between agents
+const (
+	conflictVertex = "vertex"
+	conflictSwap   = "swap"
+)
+
+// MazeAgent is one of several robots moving through a maze at once
+type MazeAgent struct {
+	ID    string   `json:"id"`
+	Start Position `json:"start"`
+	Goal  Position `json:"goal"`
+}
+
+// AgentConflict is a collision between two agents of a multi-agent maze
+type AgentConflict struct {
+	// Type is "vertex" when the agents are on the same cell at the same time,
+	// and "swap" when they trade cells during the same step
+	Type   string   `json:"type"`
+	Time   int      `json:"time"`
+	Agents []string `json:"agents"`
+	// Cell is where the agents meet; for a swap, the cell the first agent enters
+	Cell Position `json:"cell"`
+	// From is the cell the first agent leaves during a swap
+	From *Position `json:"from,omitempty"`
+}
+
+// forAgent returns the maze as seen by one agent, running from its start to its goal
+func (g *MazeGrid) forAgent(agent MazeAgent) *MazeGrid {
+	view := *g
+	view.Start, view.Goal = agent.Start, agent.Goal
+	return &view
+}
+
+// starts returns the start of every agent of a maze, or the maze's start without agents
+func (g *MazeGrid) starts() []Position {
+	if len(g.Agents) == 0 {
+		return []Position{g.Start}
+	}
+	starts := make([]Position, len(g.Agents))
+	for i, agent := range g.Agents {
+		starts[i] = agent.Start
+	}
+	return starts
+}
+
+// agent returns the agent with an ID, or nil
+func (g *MazeGrid) agent(id string) *MazeAgent {
+	for i := range g.Agents {
+		if g.Agents[i].ID == id {
+			return &g.Agents[i]
+		}
+	}
+	return nil
+}
+
+// validateAgents checks that the agents of a maze have distinct IDs, starts
+// and goals on open cells, and that each can reach its goal on its own
+func validateAgents(g *MazeGrid) error {
+	ids := make(map[string]bool)
+	starts := make(map[Position]string)
+	goals := make(map[Position]string)
+	for _, agent := range g.Agents {
+		if agent.ID == "" || ids[agent.ID] {
+			return fmt.Errorf("agents need distinct IDs")
+		}
+		ids[agent.ID] = true
+		for _, end := range []Position{agent.Start, agent.Goal} {
+			if !g.contains(end) || g.isBlocked(end) {
+				return fmt.Errorf("agent '%s': %v must be an open cell of the grid", agent.ID, end)
+			}
+		}
+		if other, ok := starts[agent.Start]; ok {
+			return fmt.Errorf("agents '%s' and '%s' start on the same cell", other, agent.ID)
+		}
+		if other, ok := goals[agent.Goal]; ok {
+			return fmt.Errorf("agents '%s' and '%s' share a goal", other, agent.ID)
+		}
+		starts[agent.Start], goals[agent.Goal] = agent.ID, agent.ID
+		if _, ok := g.forAgent(agent).cheapestPath(); !ok {
+			return fmt.Errorf("agent '%s' cannot reach its goal %v", agent.ID, agent.Goal)
+		}
+	}
+	return nil
+}
+
+// verifyAgentPaths checks a timed path for every agent of a maze. Entry t
+// of a path is where the agent is at time t, and repeating a cell waits
+// there; agents stay on their goal once their path ends. Each path must
+// follow the rules of the maze, and no two agents may be on the same cell
+// at the same time or trade cells during the same step.
+func verifyAgentPaths(result PuzzleVerificationResult, grid MazeGrid, paths map[string][]Position) PuzzleVerificationResult {
+	ids := make([]string, 0, len(paths))
+	for id := range paths {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		if grid.agent(id) == nil {
+			result.Message = fmt.Sprintf("'%s' is not an agent of this maze", id)
+			return result
+		}
+	}
+
+	makespan := 0
+	for _, agent := range grid.Agents {
+		path := paths[agent.ID]
+		if len(path) == 0 {
+			result.Message = fmt.Sprintf("Path for agent '%s' is missing", agent.ID)
+			return result
+		}
+		if path[0] != agent.Start {
+			result.Message = fmt.Sprintf("Agent '%s' must start at %v", agent.ID, agent.Start)
+			return result
+		}
+		if end := path[len(path)-1]; end != agent.Goal {
+			result.Message = fmt.Sprintf("Agent '%s' must end at %v", agent.ID, agent.Goal)
+			return result
+		}
+		walker := newMazeWalker(grid.forAgent(agent))
+		for t, next := range path[1:] {
+			if next == walker.pos && !walker.teleporting {
+				continue
+			}
+			if err := walker.move(next); err != nil {
+				result.Message = fmt.Sprintf("Agent '%s' at time %d: %v", agent.ID, t+1, err)
+				return result
+			}
+		}
+		if len(path)-1 > makespan {
+			makespan = len(path) - 1
+		}
+	}
+
+	// at returns where an agent is at a time, waiting on its goal after its path ends
+	at := func(agent MazeAgent, t int) Position {
+		path := paths[agent.ID]
+		if t >= len(path) {
+			return agent.Goal
+		}
+		return path[t]
+	}
+	for t := 0; t <= makespan; t++ {
+		if conflict := findAgentConflict(grid.Agents, at, t); conflict != nil {
+			result.Conflict = conflict
+			if conflict.Type == conflictSwap {
+				result.Message = fmt.Sprintf("Agents '%s' and '%s' swap cells %v and %v between time %d and %d",
+					conflict.Agents[0], conflict.Agents[1], *conflict.From, conflict.Cell, t-1, t)
+			} else {
+				result.Message = fmt.Sprintf("Agents '%s' and '%s' are both on %v at time %d",
+					conflict.Agents[0], conflict.Agents[1], conflict.Cell, t)
+			}
+			return result
+		}
+	}
+
+	result.Valid = true
+	result.Message = fmt.Sprintf("All %d agents reach their goals without collisions by time %d", len(grid.Agents), makespan)
+	return result
+}
+
+// findAgentConflict returns the first collision at a time between agents,
+// in the order they are declared: a swap during the step that ends at that
+// time, then two agents sharing a cell
+func findAgentConflict(agents []MazeAgent, at func(MazeAgent, int) Position, t int) *AgentConflict {
+	if t > 0 {
+		for i, a := range agents {
+			for _, b := range agents[i+1:] {
+				fromA, toA := at(a, t-1), at(a, t)
+				if fromA != toA && fromA == at(b, t) && toA == at(b, t-1) {
+					return &AgentConflict{Type: conflictSwap, Time: t, Agents: []string{a.ID, b.ID}, Cell: toA, From: &fromA}
+				}
+			}
+		}
+	}
+	for i, a := range agents {
+		for _, b := range agents[i+1:] {
+			if cell := at(a, t); cell == at(b, t) {
+				return &AgentConflict{Type: conflictVertex, Time: t, Agents: []string{a.ID, b.ID}, Cell: cell}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Limits of generated mazes
+const (
+	minGeneratedMazeSize = 2
+	maxGeneratedMazeSize = 64
+)
+
+// MazeGenerator describes a maze to generate. The same generator always
+// gives the same maze, so a puzzle can ship it instead of the full grid.
+type MazeGenerator struct {
+	Seed   int64 `json:"seed"`
+	Width  int   `json:"width"`
+	Height int   `json:"height"`
+	// Difficulty picks a preset profile: "easy", "medium" (the default) or "hard"
+	Difficulty string `json:"difficulty,omitempty"`
+	// Profile overrides the preset of the difficulty
+	Profile *MazeProfile `json:"profile,omitempty"`
+}
+
+// MazeProfile shapes a generated maze
+type MazeProfile struct {
+	// DeadEnds is the share of dead ends kept, from 0 (none) to 1 (all those of a maze without loops)
+	DeadEnds float64 `json:"deadEnds"`
+	// Loops is the share of the remaining inner walls knocked down to open alternative routes
+	Loops float64 `json:"loops"`
+	// PathLength places the goal, from 0 (next to the start) to 1 (the cell farthest from it)
+	PathLength float64 `json:"pathLength"`
+}
+
+// mazeProfiles are the preset profiles of each difficulty
+var mazeProfiles = map[string]MazeProfile{
+	"easy":   {DeadEnds: 0.2, Loops: 0.1, PathLength: 0.5},
+	"medium": {DeadEnds: 0.6, Loops: 0.05, PathLength: 0.8},
+	"hard":   {DeadEnds: 1, Loops: 0, PathLength: 1},
+}
+
+// mazeRand is a SplitMix64 generator. It is spelled out here rather than
+// taken from math/rand so that clients in other languages can reproduce
+// the sequence, and with it the maze, from the seed alone.
+type mazeRand struct {
+	state uint64
+}
+
+// next returns the next 64 random bits
+func (r *mazeRand) next() uint64 {
+	r.state += 0x9E3779B97F4A7C15
+	z := r.state
+	z = (z ^ (z >> 30)) * 0xBF58476D1CE4E5B9
+	z = (z ^ (z >> 27)) * 0x94D049BB133111EB
+	return z ^ (z >> 31)
+}
+
+// intn returns a number in [0, n)
+func (r *mazeRand) intn(n int) int {
+	return int(r.next() % uint64(n))
+}
+
+// float returns a number in [0, 1)
+func (r *mazeRand) float() float64 {
+	return float64(r.next()>>11) / (1 << 53)
+}
+
+// mazeCells tracks the open passages between the cells of a generated maze
+type mazeCells struct {
+	width, height int
+	// east and south tell whether a cell opens onto its right and lower neighbours
+	east, south []bool
+}
+
+// Directions in the order neighbours are considered: east, south, west, north
+var mazeDirections = []Position{{X: 1}, {Y: 1}, {X: -1}, {Y: -1}}
+
+// neighbour returns the cell next to cell in a direction, if it is inside the grid
+func (m *mazeCells) neighbour(cell int, dir Position) (int, bool) {
+	x, y := cell%m.width+dir.X, cell/m.width+dir.Y
+	if x < 0 || y < 0 || x >= m.width || y >= m.height {
+		return 0, false
+	}
+	return y*m.width + x, true
+}
+
+// passage returns the flag of the passage between a cell and its neighbour in a direction
+func (m *mazeCells) passage(cell int, dir Position) *bool {
+	switch dir {
+	case Position{X: 1}:
+		return &m.east[cell]
+	case Position{Y: 1}:
+		return &m.south[cell]
+	case Position{X: -1}:
+		return &m.east[cell-1]
+	}
+	return &m.south[cell-m.width]
+}
+
+// openSides counts the open passages of a cell
+func (m *mazeCells) openSides(cell int) int {
+	open := 0
+	for _, dir := range mazeDirections {
+		if _, ok := m.neighbour(cell, dir); ok && *m.passage(cell, dir) {
+			open++
+		}
+	}
+	return open
+}
+
+// carve builds a maze without loops with a randomized depth-first search from the first cell
+func (m *mazeCells) carve(rng *mazeRand) {
+	visited := make([]bool, m.width*m.height)
+	visited[0] = true
+	stack := []int{0}
+	for len(stack) > 0 {
+		cell := stack[len(stack)-1]
+		var dirs []Position
+		for _, dir := range mazeDirections {
+			if next, ok := m.neighbour(cell, dir); ok && !visited[next] {
+				dirs = append(dirs, dir)
+			}
+		}
+		if len(dirs) == 0 {
+			stack = stack[:len(stack)-1]
+			continue
+		}
+		dir := dirs[rng.intn(len(dirs))]
+		next, _ := m.neighbour(cell, dir)
+		*m.passage(cell, dir) = true
+		visited[next] = true
+		stack = append(stack, next)
+	}
+}
+
+// braid opens one more side of each dead end, except for the share of dead ends to keep
+func (m *mazeCells) braid(rng *mazeRand, keep float64) {
+	for cell := 0; cell < m.width*m.height; cell++ {
+		if m.openSides(cell) != 1 || rng.float() < keep {
+			continue
+		}
+		var closed []Position
+		for _, dir := range mazeDirections {
+			if _, ok := m.neighbour(cell, dir); ok && !*m.passage(cell, dir) {
+				closed = append(closed, dir)
+			}
+		}
+		if len(closed) > 0 {
+			*m.passage(cell, closed[rng.intn(len(closed))]) = true
+		}
+	}
+}
+
+// addLoops knocks down a share of the remaining inner walls
+func (m *mazeCells) addLoops(rng *mazeRand, share float64) {
+	for cell := 0; cell < m.width*m.height; cell++ {
+		for _, dir := range mazeDirections[:2] {
+			if _, ok := m.neighbour(cell, dir); ok && !*m.passage(cell, dir) && rng.float() < share {
+				*m.passage(cell, dir) = true
+			}
+		}
+	}
+}
+
+// distances returns the number of steps from the first cell to every cell,
+// and the cell each one is reached from
+func (m *mazeCells) distances() ([]int, []int) {
+	dist := make([]int, m.width*m.height)
+	from := make([]int, m.width*m.height)
+	for i := range dist {
+		dist[i] = -1
+	}
+	dist[0] = 0
+	queue := []int{0}
+	for len(queue) > 0 {
+		cell := queue[0]
+		queue = queue[1:]
+		for _, dir := range mazeDirections {
+			next, ok := m.neighbour(cell, dir)
+			if !ok || !*m.passage(cell, dir) || dist[next] >= 0 {
+				continue
+			}
+			dist[next] = dist[cell] + 1
+			from[next] = cell
+			queue = append(queue, next)
+		}
+	}
+	return dist, from
+}
+
+// position returns the coordinates of a cell
+func (m *mazeCells) position(cell int) Position {
+	return Position{X: cell % m.width, Y: cell / m.width}
+}
+
+// profile returns the profile of the generator, from its difficulty unless given
+func (g MazeGenerator) profile() (MazeProfile, error) {
+	if g.Profile != nil {
+		return *g.Profile, nil
+	}
+	difficulty := strings.ToLower(g.Difficulty)
+	if difficulty == "" {
+		difficulty = "medium"
+	}
+	profile, ok := mazeProfiles[difficulty]
+	if !ok {
+		return MazeProfile{}, fmt.Errorf("unknown difficulty '%s'", g.Difficulty)
+	}
+	return profile, nil
+}
+
+// GenerateMaze builds the grid of a maze and its shortest solution. The
+// start is the top-left cell; the goal is the cell whose distance from the
+// start is closest to the profile's share of the longest distance.
+func GenerateMaze(g MazeGenerator) (MazeGrid, []Position, error) {
+	if g.Width < minGeneratedMazeSize || g.Height < minGeneratedMazeSize ||
+		g.Width > maxGeneratedMazeSize || g.Height > maxGeneratedMazeSize {
+		return MazeGrid{}, nil, fmt.Errorf("generated mazes are %d to %d cells wide and high", minGeneratedMazeSize, maxGeneratedMazeSize)
+	}
+	profile, err := g.profile()
+	if err != nil {
+		return MazeGrid{}, nil, err
+	}
+
+	rng := &mazeRand{state: uint64(g.Seed)}
+	cells := &mazeCells{
+		width:  g.Width,
+		height: g.Height,
+		east:   make([]bool, g.Width*g.Height),
+		south:  make([]bool, g.Width*g.Height),
+	}
+	cells.carve(rng)
+	cells.braid(rng, profile.DeadEnds)
+	cells.addLoops(rng, profile.Loops)
+
+	dist, from := cells.distances()
+	longest := 0
+	for _, d := range dist {
+		if d > longest {
+			longest = d
+		}
+	}
+	target := int(math.Max(1, math.Round(profile.PathLength*float64(longest))))
+	goal := 0
+	for cell, d := range dist {
+		if abs(d-target) < abs(dist[goal]-target) {
+			goal = cell
+		}
+	}
+
+	grid := MazeGrid{Width: g.Width, Height: g.Height, Start: cells.position(0), Goal: cells.position(goal)}
+	for cell := 0; cell < g.Width*g.Height; cell++ {
+		for _, dir := range mazeDirections[:2] {
+			if next, ok := cells.neighbour(cell, dir); ok && !*cells.passage(cell, dir) {
+				grid.Walls = append(grid.Walls, MazeWall{From: cells.position(cell), To: cells.position(next)})
+			}
+		}
+	}
+
+	path := make([]Position, dist[goal]+1)
+	for cell, i := goal, dist[goal]; i >= 0; cell, i = from[cell], i-1 {
+		path[i] = cells.position(cell)
+	}
+	return grid, path, nil
+}
+
+// GenerateMazePuzzle builds a complete maze puzzle with its grid and shortest solution
+func GenerateMazePuzzle(id string, g MazeGenerator) (Puzzle, error) {
+	puzzle := Puzzle{ID: id, Type: TypeMaze, Generator: &g}
+	if err := expandMazeGenerator(&puzzle); err != nil {
+		return Puzzle{}, err
+	}
+	difficulty := strings.ToLower(g.Difficulty)
+	if difficulty == "" {
+		difficulty = "medium"
+	}
+	puzzle.Name = fmt.Sprintf("Generated Maze %d", g.Seed)
+	puzzle.Description = fmt.Sprintf("Find a path from the start (%d,%d) to the end (%d,%d)",
+		puzzle.Maze.Start.X, puzzle.Maze.Start.Y, puzzle.Maze.Goal.X, puzzle.Maze.Goal.Y)
+	puzzle.Difficulty = strings.ToUpper(difficulty[:1]) + difficulty[1:]
+	return puzzle, nil
+}
+
+// expandMazeGenerator fills the grid and solution of a puzzle from its
+// generator, replacing any that were stored with it
+func expandMazeGenerator(puzzle *Puzzle) error {
+	if puzzle.Generator == nil {
+		return nil
+	}
+	grid, path, err := GenerateMaze(*puzzle.Generator)
+	if err != nil {
+		return err
+	}
+	solution, err := json.Marshal(MazeSolution{Path: path})
+	if err != nil {
+		return err
+	}
+	puzzle.Maze = &grid
+	puzzle.Solution = solution
+	return nil
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"container/heap"
+	"fmt"
+)
+
+// maxMazeKeys bounds the keys of a maze, since the shortest path search tracks every set of keys held
+const maxMazeKeys = 16
+
+// MazeKey is a key lying on a cell, picked up when the path enters it
+type MazeKey struct {
+	ID string   `json:"id"`
+	At Position `json:"at"`
+}
+
+// MazeDoor is a cell that can only be entered while holding its key
+type MazeDoor struct {
+	Key string   `json:"key"`
+	At  Position `json:"at"`
+}
+
+// MazeOneWay is a conveyor tile that can only be left in its direction,
+// one of the directions of the maze's topology
+type MazeOneWay struct {
+	At        Position `json:"at"`
+	Direction string   `json:"direction"`
+}
+
+// MazeTeleporter moves a path that walks onto From straight to To
+type MazeTeleporter struct {
+	From Position `json:"from"`
+	To   Position `json:"to"`
+}
+
+// MazeTerrain makes entering its cells cost more than the single step of plain floor
+type MazeTerrain struct {
+	Name  string     `json:"name,omitempty"`
+	Cost  int        `json:"cost"`
+	Cells []Position `json:"cells"`
+}
+
+// keyIndex returns the index of a key, or -1
+func (g *MazeGrid) keyIndex(id string) int {
+	for i, key := range g.Keys {
+		if key.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// doorAt returns the door on a cell
+func (g *MazeGrid) doorAt(p Position) (MazeDoor, bool) {
+	for _, door := range g.Doors {
+		if door.At == p {
+			return door, true
+		}
+	}
+	return MazeDoor{}, false
+}
+
+// oneWayAt returns the one-way tile on a cell
+func (g *MazeGrid) oneWayAt(p Position) (MazeOneWay, bool) {
+	for _, tile := range g.OneWay {
+		if tile.At == p {
+			return tile, true
+		}
+	}
+	return MazeOneWay{}, false
+}
+
+// teleporterAt returns the teleporter whose entrance is on a cell
+func (g *MazeGrid) teleporterAt(p Position) (MazeTeleporter, bool) {
+	for _, teleporter := range g.Teleporters {
+		if teleporter.From == p {
+			return teleporter, true
+		}
+	}
+	return MazeTeleporter{}, false
+}
+
+// cost returns the cost of entering a cell
+func (g *MazeGrid) cost(p Position) int {
+	for _, terrain := range g.Terrain {
+		for _, cell := range terrain.Cells {
+			if cell == p {
+				return terrain.Cost
+			}
+		}
+	}
+	return 1
+}
+
+// validateMechanics checks the keys, doors, one-way tiles, teleporters and terrain of a maze
+func validateMechanics(g *MazeGrid) error {
+	open := func(what string, p Position) error {
+		if !g.contains(p) || g.isBlocked(p) {
+			return fmt.Errorf("%s at %v must be on an open cell of the grid", what, p)
+		}
+		return nil
+	}
+
+	if len(g.Keys) > maxMazeKeys {
+		return fmt.Errorf("mazes have at most %d keys", maxMazeKeys)
+	}
+	for i, key := range g.Keys {
+		if key.ID == "" || g.keyIndex(key.ID) != i {
+			return fmt.Errorf("keys need distinct IDs")
+		}
+		if err := open(fmt.Sprintf("key '%s'", key.ID), key.At); err != nil {
+			return err
+		}
+	}
+	for _, door := range g.Doors {
+		if err := open("door", door.At); err != nil {
+			return err
+		}
+		if g.keyIndex(door.Key) < 0 {
+			return fmt.Errorf("door at %v needs unknown key '%s'", door.At, door.Key)
+		}
+		for _, start := range g.starts() {
+			if door.At == start {
+				return fmt.Errorf("door at %v is on the start", door.At)
+			}
+		}
+	}
+	for _, tile := range g.OneWay {
+		if err := open("one-way tile", tile.At); err != nil {
+			return err
+		}
+		if !containsString(g.topology().directions(), tile.Direction) {
+			return fmt.Errorf("one-way tile at %v has unknown direction '%s'", tile.At, tile.Direction)
+		}
+	}
+	entrances := make(map[Position]bool)
+	for _, teleporter := range g.Teleporters {
+		if err := open("teleporter", teleporter.From); err != nil {
+			return err
+		}
+		if err := open("teleporter exit", teleporter.To); err != nil {
+			return err
+		}
+		if teleporter.From == teleporter.To {
+			return fmt.Errorf("teleporter at %v leads to itself", teleporter.From)
+		}
+		if entrances[teleporter.From] {
+			return fmt.Errorf("two teleporters start at %v", teleporter.From)
+		}
+		entrances[teleporter.From] = true
+	}
+	for _, terrain := range g.Terrain {
+		if terrain.Cost < 1 {
+			return fmt.Errorf("terrain '%s' must cost at least 1", terrain.Name)
+		}
+		for _, cell := range terrain.Cells {
+			if !g.contains(cell) {
+				return fmt.Errorf("terrain '%s' at %v is outside the grid", terrain.Name, cell)
+			}
+		}
+	}
+	return nil
+}
+
+// mazeWalker follows a path through a maze, tracking the keys it holds
+type mazeWalker struct {
+	grid *MazeGrid
+	pos  Position
+	keys uint32
+	// teleporting is set when the walker has walked onto a teleporter entrance
+	teleporting bool
+	// steps counts the moves walked, and cost their total cost; teleports are free
+	steps, cost int
+}
+
+// newMazeWalker puts a walker on the start, picking up any key lying there
+func newMazeWalker(g *MazeGrid) mazeWalker {
+	w := mazeWalker{grid: g, pos: g.Start}
+	w.pickUp()
+	return w
+}
+
+// pickUp takes the key on the walker's cell, if any
+func (w *mazeWalker) pickUp() {
+	for i, key := range w.grid.Keys {
+		if key.At == w.pos {
+			w.keys |= 1 << uint(i)
+		}
+	}
+}
+
+// move takes the walker to the next cell of a path, by a step to a
+// neighbouring cell or through the teleporter it stands on, and describes
+// the rule the move breaks, if any
+func (w *mazeWalker) move(next Position) error {
+	g, prev := w.grid, w.pos
+	if w.teleporting {
+		teleporter, _ := g.teleporterAt(prev)
+		if next != teleporter.To {
+			return fmt.Errorf("teleporter at %v leads to %v, not %v", prev, teleporter.To, next)
+		}
+		w.teleporting = false
+	} else {
+		switch {
+		case !g.contains(next):
+			return fmt.Errorf("%v is outside the maze", next)
+		case !g.isNeighbour(prev, next) && !g.isLinked(prev, next):
+			return fmt.Errorf("%v is not next to %v", next, prev)
+		case g.isBlocked(next):
+			return fmt.Errorf("blocked cell %v entered", next)
+		case g.hasWall(prev, next):
+			return fmt.Errorf("wall between %v and %v crossed", prev, next)
+		case g.cornerSealed(prev, next):
+			return fmt.Errorf("sealed corner between %v and %v crossed", prev, next)
+		}
+		if tile, ok := g.oneWayAt(prev); ok {
+			if ahead, _ := g.topology().step(prev, tile.Direction); next != ahead {
+				return fmt.Errorf("one-way tile at %v left against its direction (%s)", prev, tile.Direction)
+			}
+		}
+		w.steps++
+		w.cost += g.cost(next)
+		_, w.teleporting = g.teleporterAt(next)
+	}
+
+	if door, ok := g.doorAt(next); ok && w.keys&(1<<uint(g.keyIndex(door.Key))) == 0 {
+		return fmt.Errorf("door at %v entered without key '%s'", next, door.Key)
+	}
+	w.pos = next
+	w.pickUp()
+	return nil
+}
+
+// mazeState identifies where a walker is and what it holds
+type mazeState struct {
+	pos         Position
+	keys        uint32
+	teleporting bool
+}
+
+// walkerQueue is a priority queue of walkers, cheapest first, then fewest steps
+type walkerQueue []mazeWalker
+
+func (q walkerQueue) Len() int { return len(q) }
+func (q walkerQueue) Less(i, j int) bool {
+	return q[i].cost < q[j].cost || (q[i].cost == q[j].cost && q[i].steps < q[j].steps)
+}
+func (q walkerQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *walkerQueue) Push(x interface{}) { *q = append(*q, x.(mazeWalker)) }
+func (q *walkerQueue) Pop() interface{} {
+	old := *q
+	w := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return w
+}
+
+// cheapestPath searches the cheapest path from the start to the goal with
+// Dijkstra's algorithm over cells and held keys. It returns the walker that
+// reaches the goal, or false if none can.
+func (g *MazeGrid) cheapestPath() (mazeWalker, bool) {
+	done := make(map[mazeState]bool)
+	queue := &walkerQueue{newMazeWalker(g)}
+	for queue.Len() > 0 {
+		w := heap.Pop(queue).(mazeWalker)
+		state := mazeState{pos: w.pos, keys: w.keys, teleporting: w.teleporting}
+		if done[state] {
+			continue
+		}
+		done[state] = true
+		if w.pos == g.Goal {
+			return w, true
+		}
+
+		moves := g.moves(w.pos)
+		if w.teleporting {
+			teleporter, _ := g.teleporterAt(w.pos)
+			moves = []Position{teleporter.To}
+		}
+		for _, next := range moves {
+			moved := w
+			if moved.move(next) == nil {
+				heap.Push(queue, moved)
+			}
+		}
+	}
+	return mazeWalker{}, false
+}
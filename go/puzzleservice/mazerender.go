@@ -0,0 +1,299 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Layout of a rendered maze. Floors of a layered maze are drawn side by
+// side, each under its label.
+const (
+	mazeRenderMargin = 20.0
+	// mazeRenderCell is the side of a square cell, or the radius of a hexagon
+	mazeRenderCell     = 32.0
+	mazeRenderFloorGap = 30.0
+	mazeRenderLabel    = 20.0
+)
+
+// Colors used to draw mazes
+const (
+	mazeRenderBlocked  = "#444444"
+	mazeRenderStart    = "#2ca02c"
+	mazeRenderGoal     = "#d62728"
+	mazeRenderPath     = "#1f77b4"
+	mazeRenderBroken   = "#d62728"
+	mazeRenderKey      = "#e6b800"
+	mazeRenderDoor     = "#8c564b"
+	mazeRenderPortal   = "#9467bd"
+	mazeRenderLink     = "#ff7f0e"
+	mazeRenderTerrain  = "#c7a26b"
+	mazeRenderOpenCell = "white"
+)
+
+// mazeRenderAgents are the colors of the paths of the agents of a maze, in turn
+var mazeRenderAgents = []string{"#1f77b4", "#2ca02c", "#9467bd", "#17becf", "#bcbd22", "#e377c2"}
+
+// RenderMazeSVG draws the grid of a maze puzzle and its stored solution as
+// an SVG image, following the maze's topology. Given a submitted solution, it
+// draws the submitted path instead, from the first rule it breaks on in red.
+// The path of a rover puzzle is the trajectory of its program, and the
+// agents of a multi-agent maze each get a path of their own color, with
+// their first collision circled.
+func RenderMazeSVG(puzzle Puzzle, solution json.RawMessage) (string, error) {
+	if (puzzle.Type != TypeMaze && puzzle.Type != TypeRover) || puzzle.Maze == nil {
+		return "", fmt.Errorf("puzzle '%s' is not a maze puzzle with a grid", puzzle.ID)
+	}
+	if puzzle.Fog != nil {
+		return "", fmt.Errorf("puzzle '%s' is hidden by fog and can only be explored in a session", puzzle.ID)
+	}
+	if solution == nil {
+		solution = puzzle.Solution
+	}
+	g := puzzle.Maze
+
+	var mazeSolution MazeSolution
+	if puzzle.Type == TypeRover {
+		var roverSolution RoverSolution
+		if err := json.Unmarshal(solution, &roverSolution); err != nil {
+			return "", fmt.Errorf("invalid rover solution format: %v", err)
+		}
+		commands, err := ParseRoverProgram(roverSolution.Program)
+		if err != nil {
+			return "", fmt.Errorf("invalid program: %v", err)
+		}
+		spec := RoverSpec{}
+		if puzzle.Rover != nil {
+			spec = *puzzle.Rover
+		}
+		mazeSolution.Path = runRover(g, spec, commands).trajectory
+	} else if err := json.Unmarshal(solution, &mazeSolution); err != nil {
+		return "", fmt.Errorf("invalid maze solution format: %v", err)
+	}
+
+	floorWidth, floorHeight := mazeFloorSize(g)
+	width := 2*mazeRenderMargin + float64(g.floors())*floorWidth + float64(g.floors()-1)*mazeRenderFloorGap
+	height := 2*mazeRenderMargin + mazeRenderLabel + floorHeight
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%g" height="%g" viewBox="0 0 %g %g" font-family="sans-serif" font-size="11">`+"\n", width, height, width, height)
+	fmt.Fprintf(&b, "<title>%s</title>\n", escapeXML(puzzle.Name))
+	fmt.Fprintf(&b, `<rect width="100%%" height="100%%" fill="white"/>`+"\n")
+
+	for z := 0; z < g.floors(); z++ {
+		x := mazeRenderMargin + float64(z)*(floorWidth+mazeRenderFloorGap)
+		label := fmt.Sprintf("Floor %d", z)
+		if g.floors() == 1 {
+			label = fmt.Sprintf("%s maze", g.topologyName())
+		}
+		fmt.Fprintf(&b, `<text x="%g" y="%g">%s</text>`+"\n", x, mazeRenderMargin+12, label)
+		for y := 0; y < g.Height; y++ {
+			for x := 0; x < g.Width; x++ {
+				drawMazeCell(&b, g, Position{X: x, Y: y, Z: z})
+			}
+		}
+	}
+
+	for _, wall := range g.Walls {
+		drawMazeWall(&b, g, wall)
+	}
+	for _, link := range g.Links {
+		from, to := mazeCellCenter(g, link.From), mazeCellCenter(g, link.To)
+		fmt.Fprintf(&b, `<line x1="%g" y1="%g" x2="%g" y2="%g" stroke="%s" stroke-width="1.5" stroke-dasharray="4 3"/>`+"\n",
+			from.X, from.Y, to.X, to.Y, mazeRenderLink)
+	}
+	for _, teleporter := range g.Teleporters {
+		from, to := mazeCellCenter(g, teleporter.From), mazeCellCenter(g, teleporter.To)
+		fmt.Fprintf(&b, `<line x1="%g" y1="%g" x2="%g" y2="%g" stroke="%s" stroke-width="1" stroke-dasharray="2 3"/>`+"\n",
+			from.X, from.Y, to.X, to.Y, mazeRenderPortal)
+	}
+
+	// Paths go on top
+	if len(g.Agents) == 0 {
+		drawMazePath(&b, g, mazeSolution.Path, mazeRenderPath, false)
+	}
+	for i, agent := range g.Agents {
+		drawMazePath(&b, g.forAgent(agent), mazeSolution.Paths[agent.ID], mazeRenderAgents[i%len(mazeRenderAgents)], true)
+	}
+	if len(g.Agents) > 0 {
+		checked := verifyAgentPaths(PuzzleVerificationResult{}, *g, mazeSolution.Paths)
+		if conflict := checked.Conflict; conflict != nil {
+			c := mazeCellCenter(g, conflict.Cell)
+			fmt.Fprintf(&b, `<circle cx="%g" cy="%g" r="%g" fill="none" stroke="%s" stroke-width="3"/>`+"\n",
+				c.X, c.Y, mazeRenderCell/2, mazeRenderBroken)
+		}
+	}
+
+	b.WriteString("</svg>\n")
+	return b.String(), nil
+}
+
+// drawMazePath draws a path from the start of a maze, turning red from the
+// first step that breaks a rule. Jumps through links and teleporters are
+// dashed. Agents may wait on a cell, which draws nothing.
+func drawMazePath(b *strings.Builder, g *MazeGrid, path []Position, color string, waits bool) {
+	// broken is the index of the first path cell that breaks a rule
+	broken := 0
+	if len(path) > 0 && path[0] == g.Start {
+		broken = len(path)
+		walker := newMazeWalker(g)
+		for i, next := range path[1:] {
+			if waits && next == walker.pos && !walker.teleporting {
+				continue
+			}
+			if walker.move(next) != nil {
+				broken = i + 1
+				break
+			}
+		}
+	}
+
+	for i := 1; i < len(path); i++ {
+		prev, next := path[i-1], path[i]
+		if prev == next {
+			continue
+		}
+		from, to := mazeCellCenter(g, prev), mazeCellCenter(g, next)
+		stroke, dash := color, ""
+		if i >= broken {
+			stroke = mazeRenderBroken
+		}
+		if !g.isNeighbour(prev, next) {
+			dash = ` stroke-dasharray="6 4"`
+		}
+		fmt.Fprintf(b, `<line x1="%g" y1="%g" x2="%g" y2="%g" stroke="%s" stroke-width="3" stroke-linecap="round"%s/>`+"\n",
+			from.X, from.Y, to.X, to.Y, stroke, dash)
+	}
+}
+
+// mazeFloorSize returns the width and height of one drawn floor
+func mazeFloorSize(g *MazeGrid) (float64, float64) {
+	if g.topologyName() == topologyHex {
+		w := math.Sqrt(3) * mazeRenderCell
+		return roundTenth((float64(g.Width) + 0.5) * w), (1.5*float64(g.Height) + 0.5) * mazeRenderCell
+	}
+	return float64(g.Width) * mazeRenderCell, float64(g.Height) * mazeRenderCell
+}
+
+// mazeCellCenter returns where the center of a cell is drawn
+func mazeCellCenter(g *MazeGrid, p Position) schematicPoint {
+	floorWidth, _ := mazeFloorSize(g)
+	left := mazeRenderMargin + float64(p.Z)*(floorWidth+mazeRenderFloorGap)
+	top := mazeRenderMargin + mazeRenderLabel
+	if g.topologyName() == topologyHex {
+		w := math.Sqrt(3) * mazeRenderCell
+		return schematicPoint{
+			X: roundTenth(left + (float64(p.X)+0.5*float64(p.Y&1)+0.5)*w),
+			Y: top + mazeRenderCell + 1.5*float64(p.Y)*mazeRenderCell,
+		}
+	}
+	return schematicPoint{
+		X: left + (float64(p.X)+0.5)*mazeRenderCell,
+		Y: top + (float64(p.Y)+0.5)*mazeRenderCell,
+	}
+}
+
+// mazeCellOutline returns the corners of a cell: a square, or a pointy-topped hexagon
+func mazeCellOutline(g *MazeGrid, p Position) []schematicPoint {
+	c := mazeCellCenter(g, p)
+	if g.topologyName() == topologyHex {
+		corners := make([]schematicPoint, 6)
+		for i := range corners {
+			angle := math.Pi / 180 * float64(30+60*i)
+			corners[i] = schematicPoint{
+				roundTenth(c.X + mazeRenderCell*math.Cos(angle)),
+				roundTenth(c.Y + mazeRenderCell*math.Sin(angle)),
+			}
+		}
+		return corners
+	}
+	h := mazeRenderCell / 2
+	return []schematicPoint{{c.X - h, c.Y - h}, {c.X + h, c.Y - h}, {c.X + h, c.Y + h}, {c.X - h, c.Y + h}}
+}
+
+// drawMazeCell draws a cell with what lies on it
+func drawMazeCell(b *strings.Builder, g *MazeGrid, p Position) {
+	fill := mazeRenderOpenCell
+	switch {
+	case g.isBlocked(p):
+		fill = mazeRenderBlocked
+	case len(g.Agents) == 0 && p == g.Start:
+		fill = mazeRenderStart
+	case len(g.Agents) == 0 && p == g.Goal:
+		fill = mazeRenderGoal
+	case g.cost(p) > 1:
+		fill = mazeRenderTerrain
+	}
+	corners := mazeCellOutline(g, p)
+	coords := make([]string, len(corners))
+	for i, corner := range corners {
+		coords[i] = fmt.Sprintf("%g,%g", corner.X, corner.Y)
+	}
+	fmt.Fprintf(b, `<polygon points="%s" fill="%s" stroke="#cccccc" stroke-width="1"/>`+"\n", strings.Join(coords, " "), fill)
+
+	c := mazeCellCenter(g, p)
+	label := func(text, color string) {
+		fmt.Fprintf(b, `<text x="%g" y="%g" text-anchor="middle" fill="%s">%s</text>`+"\n", c.X, c.Y+4, color, escapeXML(text))
+	}
+	for _, agent := range g.Agents {
+		if agent.Start == p {
+			label(agent.ID, mazeRenderStart)
+		}
+		if agent.Goal == p {
+			label(agent.ID, mazeRenderGoal)
+		}
+	}
+	for _, key := range g.Keys {
+		if key.At == p {
+			fmt.Fprintf(b, `<circle cx="%g" cy="%g" r="%g" fill="%s"/>`+"\n", c.X, c.Y, mazeRenderCell/4, mazeRenderKey)
+			label(key.ID, schematicInk)
+		}
+	}
+	if door, ok := g.doorAt(p); ok {
+		fmt.Fprintf(b, `<rect x="%g" y="%g" width="%g" height="%g" fill="none" stroke="%s" stroke-width="3"/>`+"\n",
+			c.X-mazeRenderCell/4, c.Y-mazeRenderCell/4, mazeRenderCell/2, mazeRenderCell/2, mazeRenderDoor)
+		label(door.Key, mazeRenderDoor)
+	}
+	if tile, ok := g.oneWayAt(p); ok {
+		ahead, _ := g.topology().step(p, tile.Direction)
+		to := mazeCellCenter(g, ahead)
+		dx, dy := roundTenth((to.X-c.X)/4), roundTenth((to.Y-c.Y)/4)
+		fmt.Fprintf(b, `<line x1="%g" y1="%g" x2="%g" y2="%g" stroke="%s" stroke-width="2"/>`+"\n", c.X-dx, c.Y-dy, c.X+dx, c.Y+dy, schematicInk)
+		fmt.Fprintf(b, `<circle cx="%g" cy="%g" r="3" fill="%s"/>`+"\n", c.X+dx, c.Y+dy, schematicInk)
+	}
+	if _, ok := g.teleporterAt(p); ok {
+		fmt.Fprintf(b, `<circle cx="%g" cy="%g" r="%g" fill="none" stroke="%s" stroke-width="2"/>`+"\n", c.X, c.Y, 3*mazeRenderCell/8, mazeRenderPortal)
+	}
+	for _, link := range g.Links {
+		if link.From == p || link.To == p {
+			kind := link.Kind
+			if kind == "" {
+				kind = linkStairs
+			}
+			label(strings.ToUpper(kind[:1]), mazeRenderLink)
+		}
+	}
+}
+
+// drawMazeWall draws a wall across the side shared by two neighbouring cells
+func drawMazeWall(b *strings.Builder, g *MazeGrid, wall MazeWall) {
+	from, to := mazeCellCenter(g, wall.From), mazeCellCenter(g, wall.To)
+	mid := schematicPoint{(from.X + to.X) / 2, (from.Y + to.Y) / 2}
+	dx, dy := to.X-from.X, to.Y-from.Y
+	length := math.Hypot(dx, dy)
+	// A side is as long as a square cell, or as the radius of a hexagon;
+	// walls between diagonal neighbours cross the shared corner
+	half := mazeRenderCell / 2
+	if g.topologyName() != topologyHex && wall.From.X != wall.To.X && wall.From.Y != wall.To.Y {
+		half = mazeRenderCell / 4
+	}
+	nx, ny := -dy/length*half, dx/length*half
+	fmt.Fprintf(b, `<line x1="%g" y1="%g" x2="%g" y2="%g" stroke="%s" stroke-width="3" stroke-linecap="round"/>`+"\n",
+		roundTenth(mid.X-nx), roundTenth(mid.Y-ny), roundTenth(mid.X+nx), roundTenth(mid.Y+ny), schematicInk)
+}
+
+// roundTenth rounds a drawing coordinate to a tenth of a unit
+func roundTenth(v float64) float64 {
+	return math.Round(v*10) / 10
+}
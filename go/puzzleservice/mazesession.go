@@ -0,0 +1,331 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// defaultFogRadius is how many steps a player sees in a session of a puzzle without fog settings
+const defaultFogRadius = 1
+
+// FogSpec hides the maze of a puzzle from clients, which explore it in sessions instead
+type FogSpec struct {
+	// Radius is how many steps around the player a session reveals, 1 unless given
+	Radius int `json:"radius,omitempty"`
+}
+
+// MazeSession is a player exploring a maze one move at a time, stored
+// between moves as a JSON file in the sessions directory
+type MazeSession struct {
+	ID       string   `json:"id"`
+	PuzzleID string   `json:"puzzleId"`
+	Position Position `json:"position"`
+	// Keys lists the IDs of the keys the player holds
+	Keys []string `json:"keys,omitempty"`
+	// Moves counts the accepted moves; teleports are not counted
+	Moves int `json:"moves"`
+	// Cost adds up the cost of the cells entered, for mazes with terrain
+	Cost int `json:"cost,omitempty"`
+	// Visited lists each cell the player has been on, in the order first entered
+	Visited  []Position `json:"visited"`
+	Finished bool       `json:"finished"`
+}
+
+// MazeSessionView is what a client gets back after opening a session or making a move
+type MazeSessionView struct {
+	MazeSession
+	Message string `json:"message"`
+	// Rejected is set when a move breaks a rule of the maze and the player stays put
+	Rejected bool `json:"rejected,omitempty"`
+	// Visible lists the cells the player can see now
+	Visible []VisibleCell `json:"visible"`
+}
+
+// VisibleCell is a cell revealed around the player and what lies on it
+type VisibleCell struct {
+	Position
+	Blocked bool `json:"blocked,omitempty"`
+	Goal    bool `json:"goal,omitempty"`
+	// Walls lists the directions of the cell's sides that have a wall
+	Walls []string `json:"walls,omitempty"`
+	// Key is a key not yet picked up, and Door the key a door needs
+	Key        string `json:"key,omitempty"`
+	Door       string `json:"door,omitempty"`
+	OneWay     string `json:"oneWay,omitempty"`
+	Teleporter bool   `json:"teleporter,omitempty"`
+	// Links lists the cells on other floors that stairs or an elevator lead to
+	Links []Position `json:"links,omitempty"`
+	// Cost is the cost of entering the cell, when it is more than 1
+	Cost int `json:"cost,omitempty"`
+}
+
+// validateFog checks that only mazes a session can explore hide behind fog
+func validateFog(puzzle Puzzle) error {
+	if puzzle.Fog == nil {
+		return nil
+	}
+	if puzzle.Type != TypeMaze || puzzle.Maze == nil || len(puzzle.Maze.Agents) > 0 {
+		return fmt.Errorf("only maze puzzles with a grid and without agents have fog")
+	}
+	if puzzle.Fog.Radius < 0 {
+		return fmt.Errorf("fog radius must not be negative")
+	}
+	return nil
+}
+
+// fogRadius returns how many steps around the player a session of a puzzle reveals
+func fogRadius(puzzle Puzzle) int {
+	if puzzle.Fog == nil || puzzle.Fog.Radius == 0 {
+		return defaultFogRadius
+	}
+	return puzzle.Fog.Radius
+}
+
+// OpenMazeSession starts a new session on the start of a maze puzzle
+func OpenMazeSession(puzzle Puzzle) (*MazeSession, error) {
+	if puzzle.Type != TypeMaze || puzzle.Maze == nil || len(puzzle.Maze.Agents) > 0 {
+		return nil, fmt.Errorf("puzzle %s is not a maze with a grid for a single player", puzzle.ID)
+	}
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, fmt.Errorf("failed to create session ID: %v", err)
+	}
+	session := &MazeSession{ID: hex.EncodeToString(id), PuzzleID: puzzle.ID}
+	session.track(newMazeWalker(puzzle.Maze))
+	return session, nil
+}
+
+// sessionPath returns the file a session is stored in
+func sessionPath(dir, id string) (string, error) {
+	if _, err := hex.DecodeString(id); err != nil || id == "" {
+		return "", fmt.Errorf("invalid session ID '%s'", id)
+	}
+	return filepath.Join(dir, id+".json"), nil
+}
+
+// LoadMazeSession reads a session from the sessions directory
+func LoadMazeSession(dir, id string) (*MazeSession, error) {
+	path, err := sessionPath(dir, id)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("session not found: %s", id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read session: %v", err)
+	}
+	var session MazeSession
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, fmt.Errorf("failed to parse session %s: %v", id, err)
+	}
+	return &session, nil
+}
+
+// Save writes a session to the sessions directory
+func (s *MazeSession) Save(dir string) error {
+	path, err := sessionPath(dir, s.ID)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal session: %v", err)
+	}
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write session: %v", err)
+	}
+	return nil
+}
+
+// walker rebuilds the walker of a session on its maze
+func (s *MazeSession) walker(grid *MazeGrid) mazeWalker {
+	w := mazeWalker{grid: grid, pos: s.Position, steps: s.Moves, cost: s.Cost}
+	for _, id := range s.Keys {
+		if i := grid.keyIndex(id); i >= 0 {
+			w.keys |= 1 << uint(i)
+		}
+	}
+	return w
+}
+
+// track copies the state of a walker into a session, recording a newly visited cell
+func (s *MazeSession) track(w mazeWalker) {
+	s.Position, s.Moves, s.Cost = w.pos, w.steps, w.cost
+	if len(w.grid.Terrain) == 0 {
+		s.Cost = 0
+	}
+	s.Keys = nil
+	for i, key := range w.grid.Keys {
+		if w.keys&(1<<uint(i)) != 0 {
+			s.Keys = append(s.Keys, key.ID)
+		}
+	}
+	if !containsPosition(s.Visited, w.pos) {
+		s.Visited = append(s.Visited, w.pos)
+	}
+	s.Finished = w.pos == w.grid.Goal
+}
+
+// containsPosition tells whether a list holds a position
+func containsPosition(cells []Position, p Position) bool {
+	for _, cell := range cells {
+		if cell == p {
+			return true
+		}
+	}
+	return false
+}
+
+// parseSessionMove reads a move as a direction of the maze's topology, or
+// as the cell "x,y" or "x,y,z" to step to, which reaches stairs and elevators
+func parseSessionMove(grid *MazeGrid, from Position, move string) (Position, error) {
+	move = strings.ToLower(strings.TrimSpace(move))
+	if next, ok := grid.topology().step(from, move); ok {
+		return next, nil
+	}
+	parts := strings.Split(move, ",")
+	coords := make([]int, len(parts))
+	for i, part := range parts {
+		n, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || (len(parts) != 2 && len(parts) != 3) {
+			return Position{}, fmt.Errorf("invalid move '%s': expected one of %s, or a cell x,y or x,y,z",
+				move, strings.Join(grid.topology().directions(), ", "))
+		}
+		coords[i] = n
+	}
+	next := Position{X: coords[0], Y: coords[1]}
+	if len(coords) == 3 {
+		next.Z = coords[2]
+	}
+	return next, nil
+}
+
+// Move makes a move in a session, carrying the player on through a
+// teleporter it walks onto. A move that breaks a rule of the maze is
+// rejected and leaves the session as it was.
+func (s *MazeSession) Move(puzzle Puzzle, move string) (MazeSessionView, error) {
+	grid := puzzle.Maze
+	if s.Finished {
+		view := s.View(puzzle, fmt.Sprintf("Session is finished: the goal was reached in %d moves", s.Moves))
+		view.Rejected = true
+		return view, nil
+	}
+	next, err := parseSessionMove(grid, s.Position, move)
+	if err != nil {
+		return MazeSessionView{}, err
+	}
+
+	w := s.walker(grid)
+	err = w.move(next)
+	// A teleporter on the goal does not carry the player past it
+	entered, teleported := w, w.teleporting && w.pos != grid.Goal
+	if teleported && err == nil {
+		teleporter, _ := grid.teleporterAt(w.pos)
+		err = w.move(teleporter.To)
+	}
+	if err != nil {
+		view := s.View(puzzle, fmt.Sprintf("Move rejected: %v", err))
+		view.Rejected = true
+		return view, nil
+	}
+	if teleported {
+		s.track(entered)
+	}
+	s.track(w)
+
+	message := fmt.Sprintf("Moved to %v", s.Position)
+	if teleported {
+		message = fmt.Sprintf("Moved to %v and teleported to %v", entered.pos, s.Position)
+	}
+	if s.Finished {
+		best, _ := grid.cheapestPath()
+		message = fmt.Sprintf("Goal reached in %d moves; the shortest path takes %d", s.Moves, best.steps)
+	}
+	return s.View(puzzle, message), nil
+}
+
+// View reveals the cells around the player of a session
+func (s *MazeSession) View(puzzle Puzzle, message string) MazeSessionView {
+	grid := puzzle.Maze
+	view := MazeSessionView{MazeSession: *s, Message: message}
+	for _, cell := range grid.visibleFrom(s.Position, fogRadius(puzzle)) {
+		view.Visible = append(view.Visible, grid.describeCell(cell, s.Keys))
+	}
+	return view
+}
+
+// visibleFrom returns the cells within a number of steps of p on its floor,
+// ordered by floor, row and column. Sight does not cross walls or sealed
+// corners, and stops at blocked cells, which are seen themselves.
+func (g *MazeGrid) visibleFrom(p Position, radius int) []Position {
+	distance := map[Position]int{p: 0}
+	cells := []Position{p}
+	for i := 0; i < len(cells); i++ {
+		cell := cells[i]
+		if distance[cell] == radius || (cell != p && g.isBlocked(cell)) {
+			continue
+		}
+		for _, next := range g.neighbours(cell) {
+			if _, seen := distance[next]; seen || g.hasWall(cell, next) || g.cornerSealed(cell, next) {
+				continue
+			}
+			distance[next] = distance[cell] + 1
+			cells = append(cells, next)
+		}
+	}
+	sort.Slice(cells, func(i, j int) bool {
+		a, b := cells[i], cells[j]
+		if a.Z != b.Z {
+			return a.Z < b.Z
+		}
+		if a.Y != b.Y {
+			return a.Y < b.Y
+		}
+		return a.X < b.X
+	})
+	return cells
+}
+
+// describeCell lists what lies on a cell, leaving out keys already held
+func (g *MazeGrid) describeCell(p Position, held []string) VisibleCell {
+	cell := VisibleCell{Position: p, Blocked: g.isBlocked(p), Goal: p == g.Goal}
+	for _, direction := range g.topology().directions() {
+		if next, _ := g.topology().step(p, direction); g.hasWall(p, next) {
+			cell.Walls = append(cell.Walls, direction)
+		}
+	}
+	for _, key := range g.Keys {
+		if key.At == p && !containsString(held, key.ID) {
+			cell.Key = key.ID
+		}
+	}
+	if door, ok := g.doorAt(p); ok {
+		cell.Door = door.Key
+	}
+	if tile, ok := g.oneWayAt(p); ok {
+		cell.OneWay = tile.Direction
+	}
+	_, cell.Teleporter = g.teleporterAt(p)
+	for _, link := range g.Links {
+		switch p {
+		case link.From:
+			cell.Links = append(cell.Links, link.To)
+		case link.To:
+			cell.Links = append(cell.Links, link.From)
+		}
+	}
+	if cost := g.cost(p); cost > 1 {
+		cell.Cost = cost
+	}
+	return cell
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"fmt"
+)
+
+// Maze topologies
+const (
+	// topologySquare4 steps to the four cells sharing a side
+	topologySquare4 = "square4"
+	// topologySquare8 also steps diagonally
+	topologySquare8 = "square8"
+	// topologyHex lays out pointy-topped hexagons, odd rows shifted half a cell right
+	topologyHex = "hex"
+	// topologyLayered stacks square4 floors joined by stairs and elevators
+	topologyLayered = "layered"
+)
+
+// Kinds of links between floors
+const (
+	linkStairs   = "stairs"
+	linkElevator = "elevator"
+)
+
+// mazeStep is a named step between neighbouring cells of a square grid
+type mazeStep struct {
+	Direction string
+	DX, DY    int
+}
+
+// Steps of square grids, clockwise from the east; Y grows downwards
+var (
+	squareSteps = []mazeStep{
+		{"east", 1, 0}, {"south", 0, 1}, {"west", -1, 0}, {"north", 0, -1},
+	}
+	octileSteps = []mazeStep{
+		{"east", 1, 0}, {"southeast", 1, 1}, {"south", 0, 1}, {"southwest", -1, 1},
+		{"west", -1, 0}, {"northwest", -1, -1}, {"north", 0, -1}, {"northeast", 1, -1},
+	}
+)
+
+// mazeTopology decides which cells of a floor are neighbours
+type mazeTopology interface {
+	// directions lists the directions a path can step in, clockwise from the east
+	directions() []string
+	// step returns the cell next to p in a direction, which may lie outside the grid
+	step(p Position, direction string) (Position, bool)
+}
+
+// squareTopology steps between the cells of a square grid
+type squareTopology struct {
+	steps []mazeStep
+}
+
+func (t squareTopology) directions() []string {
+	names := make([]string, len(t.steps))
+	for i, s := range t.steps {
+		names[i] = s.Direction
+	}
+	return names
+}
+
+func (t squareTopology) step(p Position, direction string) (Position, bool) {
+	for _, s := range t.steps {
+		if s.Direction == direction {
+			return Position{X: p.X + s.DX, Y: p.Y + s.DY, Z: p.Z}, true
+		}
+	}
+	return Position{}, false
+}
+
+// hexTopology steps between hexagons stored in rows, where odd rows are
+// shifted half a cell right, so the diagonal neighbours depend on the row
+type hexTopology struct{}
+
+// hexDirections are the six sides of a hexagon, clockwise from the east
+var hexDirections = []string{"east", "southeast", "southwest", "west", "northwest", "northeast"}
+
+func (hexTopology) directions() []string {
+	return hexDirections
+}
+
+func (hexTopology) step(p Position, direction string) (Position, bool) {
+	// shift is 1 on odd rows, whose diagonal neighbours lie one column further right
+	shift := p.Y & 1
+	switch direction {
+	case "east":
+		return Position{X: p.X + 1, Y: p.Y, Z: p.Z}, true
+	case "west":
+		return Position{X: p.X - 1, Y: p.Y, Z: p.Z}, true
+	case "southeast":
+		return Position{X: p.X + shift, Y: p.Y + 1, Z: p.Z}, true
+	case "southwest":
+		return Position{X: p.X + shift - 1, Y: p.Y + 1, Z: p.Z}, true
+	case "northeast":
+		return Position{X: p.X + shift, Y: p.Y - 1, Z: p.Z}, true
+	case "northwest":
+		return Position{X: p.X + shift - 1, Y: p.Y - 1, Z: p.Z}, true
+	}
+	return Position{}, false
+}
+
+// mazeTopologies are the topologies a maze can declare
+var mazeTopologies = map[string]mazeTopology{
+	topologySquare4: squareTopology{steps: squareSteps},
+	topologySquare8: squareTopology{steps: octileSteps},
+	topologyHex:     hexTopology{},
+	topologyLayered: squareTopology{steps: squareSteps},
+}
+
+// MazeLink joins cells on different floors of a layered maze, both ways, in one step
+type MazeLink struct {
+	// Kind is "stairs" or "elevator"; it only changes how the link is drawn
+	Kind string   `json:"kind,omitempty"`
+	From Position `json:"from"`
+	To   Position `json:"to"`
+}
+
+// String formats a position as (x,y), or (x,y,z) above the ground floor
+func (p Position) String() string {
+	if p.Z != 0 {
+		return fmt.Sprintf("(%d,%d,%d)", p.X, p.Y, p.Z)
+	}
+	return fmt.Sprintf("(%d,%d)", p.X, p.Y)
+}
+
+// topologyName returns the topology of a maze, square4 unless declared
+func (g *MazeGrid) topologyName() string {
+	if g.Topology == "" {
+		return topologySquare4
+	}
+	return g.Topology
+}
+
+// topology returns the neighbourhood rules of a maze
+func (g *MazeGrid) topology() mazeTopology {
+	return mazeTopologies[g.topologyName()]
+}
+
+// floors returns the number of floors of a maze
+func (g *MazeGrid) floors() int {
+	if g.Depth < 1 {
+		return 1
+	}
+	return g.Depth
+}
+
+// neighbours returns the cells of the grid next to p on its floor, in the
+// order of the topology's directions
+func (g *MazeGrid) neighbours(p Position) []Position {
+	var cells []Position
+	for _, direction := range g.topology().directions() {
+		if next, _ := g.topology().step(p, direction); g.contains(next) {
+			cells = append(cells, next)
+		}
+	}
+	return cells
+}
+
+// isNeighbour tells whether two cells are next to each other on a floor
+func (g *MazeGrid) isNeighbour(a, b Position) bool {
+	for _, cell := range g.neighbours(a) {
+		if cell == b {
+			return true
+		}
+	}
+	return false
+}
+
+// isLinked tells whether a link joins two cells on different floors
+func (g *MazeGrid) isLinked(a, b Position) bool {
+	for _, link := range g.Links {
+		if (link.From == a && link.To == b) || (link.From == b && link.To == a) {
+			return true
+		}
+	}
+	return false
+}
+
+// cornerSealed tells whether a diagonal step between two cells of a square8
+// maze is shut off at the corner they share. The two other cells at that
+// corner lie on either side of the step; it is sealed when each side is
+// closed, by being blocked or by a wall on the corner next to the step.
+func (g *MazeGrid) cornerSealed(a, b Position) bool {
+	if g.topologyName() != topologySquare8 || a.X == b.X || a.Y == b.Y {
+		return false
+	}
+	closed := func(side Position) bool {
+		return g.isBlocked(side) || g.hasWall(a, side) || g.hasWall(side, b)
+	}
+	return closed(Position{X: b.X, Y: a.Y, Z: a.Z}) && closed(Position{X: a.X, Y: b.Y, Z: a.Z})
+}
+
+// moves returns the cells a path can step to from p, before the rules of
+// blocked cells, walls and mechanics: its neighbours, then the cells linked to it
+func (g *MazeGrid) moves(p Position) []Position {
+	cells := g.neighbours(p)
+	for _, link := range g.Links {
+		switch p {
+		case link.From:
+			cells = append(cells, link.To)
+		case link.To:
+			cells = append(cells, link.From)
+		}
+	}
+	return cells
+}
+
+// validateTopology checks the topology, floors and links of a maze
+func validateTopology(g *MazeGrid) error {
+	if _, ok := mazeTopologies[g.topologyName()]; !ok {
+		return fmt.Errorf("unknown topology '%s'", g.Topology)
+	}
+	if g.floors() > 1 && g.topologyName() != topologyLayered {
+		return fmt.Errorf("only layered mazes have more than one floor")
+	}
+	if len(g.Links) > 0 && g.topologyName() != topologyLayered {
+		return fmt.Errorf("only layered mazes have stairs and elevators")
+	}
+	for _, link := range g.Links {
+		if link.Kind != "" && link.Kind != linkStairs && link.Kind != linkElevator {
+			return fmt.Errorf("link from %v has unknown kind '%s'", link.From, link.Kind)
+		}
+		for _, end := range []Position{link.From, link.To} {
+			if !g.contains(end) || g.isBlocked(end) {
+				return fmt.Errorf("link end %v must be an open cell of the grid", end)
+			}
+		}
+		if link.From.Z == link.To.Z {
+			return fmt.Errorf("link from %v to %v must join different floors", link.From, link.To)
+		}
+	}
+	return nil
+}
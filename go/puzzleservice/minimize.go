@@ -0,0 +1,647 @@
+package main
+
+import (
+	"fmt"
+	"math/bits"
+)
+
+// Normal forms of a minimized expression
+const (
+	formSOP = "sop"
+	formPOS = "pos"
+)
+
+// Limits of minimization puzzles, since finding the minimum is exponential
+const (
+	// maxMinimizeVariables bounds the variables of a minimization puzzle:
+	// random functions of 7 variables minimize in tens of milliseconds, while
+	// some of 8 exhaust the search budget
+	maxMinimizeVariables = 7
+	// maxCoverNodes bounds the search for a minimal cover of prime implicants
+	maxCoverNodes = 100000
+)
+
+// MinimizeSpec declares a boolean function to minimize, either as an
+// expression or as the rows of its truth table that are true
+type MinimizeSpec struct {
+	Variables []string `json:"variables"`
+	// Target is the function as an expression over the variables
+	Target string `json:"target,omitempty"`
+	// Minterms lists the rows where the function is true, numbered with the
+	// first variable as the most significant bit
+	Minterms []int `json:"minterms,omitempty"`
+	// DontCares lists rows whose value does not matter
+	DontCares []int `json:"dontCares,omitempty"`
+	// Form requires a sum of products ("sop") or a product of sums ("pos"); either is accepted when empty
+	Form string `json:"form,omitempty"`
+	// minimal holds the cost of a minimal expression in each accepted form, found when the puzzle is loaded
+	minimal map[string]formCost
+}
+
+// Counterexample is an input for which a submitted expression differs from the target function
+type Counterexample struct {
+	Inputs   map[string]bool `json:"inputs"`
+	Expected bool            `json:"expected"`
+	Actual   bool            `json:"actual"`
+}
+
+// MinimizationResult compares a submitted expression with the target function and its minimal form
+type MinimizationResult struct {
+	Form       string `json:"form,omitempty"`
+	Equivalent bool   `json:"equivalent"`
+	Minimal    bool   `json:"minimal"`
+	// Terms and Literals measure the submission: products and literals of a
+	// sum of products, or sums and literals of a product of sums
+	Terms           int             `json:"terms"`
+	Literals        int             `json:"literals"`
+	MinimalTerms    int             `json:"minimalTerms"`
+	MinimalLiterals int             `json:"minimalLiterals"`
+	Counterexample  *Counterexample `json:"counterexample,omitempty"`
+}
+
+// formCost is the size of an expression in a normal form
+type formCost struct {
+	Terms, Literals int
+}
+
+// less orders costs by terms first, then literals
+func (c formCost) less(other formCost) bool {
+	return c.Terms < other.Terms || (c.Terms == other.Terms && c.Literals < other.Literals)
+}
+
+// String describes the cost, e.g. "2 terms and 4 literals"
+func (c formCost) String() string {
+	count := func(n int, noun string) string {
+		if n == 1 {
+			return fmt.Sprintf("1 %s", noun)
+		}
+		return fmt.Sprintf("%d %ss", n, noun)
+	}
+	return count(c.Terms, "term") + " and " + count(c.Literals, "literal")
+}
+
+// validateMinimize checks that a minimization puzzle is well formed
+func validateMinimize(spec *MinimizeSpec) error {
+	if spec == nil {
+		return nil
+	}
+	if len(spec.Variables) == 0 || len(spec.Variables) > maxMinimizeVariables {
+		return fmt.Errorf("minimization puzzles take 1 to %d variables", maxMinimizeVariables)
+	}
+	if spec.Form != "" && spec.Form != formSOP && spec.Form != formPOS {
+		return fmt.Errorf("unknown form '%s'", spec.Form)
+	}
+	if (spec.Target == "") == (spec.Minterms == nil) {
+		return fmt.Errorf("give either a target expression or minterms")
+	}
+	if spec.Target != "" {
+		expr, err := ParseBoolExpr(spec.Target)
+		if err != nil {
+			return fmt.Errorf("target: %v", err)
+		}
+		for _, variable := range expr.Variables() {
+			if !containsString(spec.Variables, variable) {
+				return fmt.Errorf("target uses '%s', which is not a variable", variable)
+			}
+		}
+	}
+	rows := 1 << len(spec.Variables)
+	minterms := make(map[int]bool)
+	for _, row := range spec.Minterms {
+		if row < 0 || row >= rows {
+			return fmt.Errorf("minterm %d is out of range", row)
+		}
+		minterms[row] = true
+	}
+	for _, row := range spec.DontCares {
+		if row < 0 || row >= rows {
+			return fmt.Errorf("don't-care %d is out of range", row)
+		}
+		if minterms[row] {
+			return fmt.Errorf("row %d is both a minterm and a don't-care", row)
+		}
+	}
+	_, err := spec.minimalCosts()
+	return err
+}
+
+// forms returns the normal forms a submission may take
+func (spec MinimizeSpec) forms() []string {
+	if spec.Form != "" {
+		return []string{spec.Form}
+	}
+	return []string{formSOP, formPOS}
+}
+
+// minimalCosts returns the cost of a minimal expression in each accepted
+// form, searching for them on the first call. The minimal product of sums
+// is the dual of the minimal sum of products of the complement.
+func (spec *MinimizeSpec) minimalCosts() (map[string]formCost, error) {
+	if spec.minimal != nil {
+		return spec.minimal, nil
+	}
+	ones, dontCares, err := spec.truthTable()
+	if err != nil {
+		return nil, err
+	}
+	zeros := make([]bool, len(ones))
+	for row := range ones {
+		zeros[row] = !ones[row] && !dontCares[row]
+	}
+	minimal := make(map[string]formCost)
+	for _, form := range spec.forms() {
+		rows := ones
+		if form == formPOS {
+			rows = zeros
+		}
+		if minimal[form], err = minimalCover(len(spec.Variables), rows, dontCares); err != nil {
+			return nil, err
+		}
+	}
+	spec.minimal = minimal
+	return minimal, nil
+}
+
+// truthTable returns, for each row, whether the function is true and
+// whether the row is a don't-care
+func (spec MinimizeSpec) truthTable() ([]bool, []bool, error) {
+	n := 1 << len(spec.Variables)
+	ones, dontCares := make([]bool, n), make([]bool, n)
+	for _, row := range spec.DontCares {
+		dontCares[row] = true
+	}
+	if spec.Target == "" {
+		for _, row := range spec.Minterms {
+			ones[row] = true
+		}
+		return ones, dontCares, nil
+	}
+
+	expr, err := ParseBoolExpr(spec.Target)
+	if err != nil {
+		return nil, nil, err
+	}
+	for row, values := range inputRows(spec.Variables) {
+		ones[row] = expr.Eval(values)
+	}
+	return ones, dontCares, nil
+}
+
+// implicant is a product term over numbered variables: the bits of mask
+// are free, and the other bits must equal those of value
+type implicant struct {
+	value, mask int
+}
+
+// primeImplicants finds the prime implicants of a function of n variables
+// with the Quine-McCluskey method, merging terms that differ in one bit
+func primeImplicants(n int, ones, dontCares []bool) []implicant {
+	current := make(map[implicant]bool)
+	for row := 0; row < 1<<n; row++ {
+		if ones[row] || dontCares[row] {
+			current[implicant{value: row}] = true
+		}
+	}
+
+	var primes []implicant
+	for len(current) > 0 {
+		next := make(map[implicant]bool)
+		merged := make(map[implicant]bool)
+		for a := range current {
+			for b := range current {
+				diff := a.value ^ b.value
+				if a.mask == b.mask && a.value < b.value && bits.OnesCount(uint(diff)) == 1 {
+					next[implicant{value: a.value &^ diff, mask: a.mask | diff}] = true
+					merged[a], merged[b] = true, true
+				}
+			}
+		}
+		for term := range current {
+			if !merged[term] {
+				primes = append(primes, term)
+			}
+		}
+		current = next
+	}
+	return primes
+}
+
+// bitset is a set of small non-negative integers
+type bitset []uint64
+
+// newBitset returns an empty set able to hold 0 to n-1
+func newBitset(n int) bitset {
+	return make(bitset, (n+63)/64)
+}
+
+func (b bitset) add(i int)      { b[i/64] |= 1 << uint(i%64) }
+func (b bitset) has(i int) bool { return b[i/64]&(1<<uint(i%64)) != 0 }
+
+// empty tells whether the set has no members
+func (b bitset) empty() bool {
+	for _, word := range b {
+		if word != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// subsetOf tells whether every member of b is also in other
+func (b bitset) subsetOf(other bitset) bool {
+	for i := range b {
+		if b[i]&^other[i] != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// and returns the members of b that are also in other
+func (b bitset) and(other bitset) bitset {
+	out := make(bitset, len(b))
+	for i := range b {
+		out[i] = b[i] & other[i]
+	}
+	return out
+}
+
+// minus returns the members of b that are not in other
+func (b bitset) minus(other bitset) bitset {
+	out := make(bitset, len(b))
+	for i := range b {
+		out[i] = b[i] &^ other[i]
+	}
+	return out
+}
+
+// without returns b less one member
+func (b bitset) without(i int) bitset {
+	out := append(bitset(nil), b...)
+	out[i/64] &^= 1 << uint(i%64)
+	return out
+}
+
+// coverSearch finds the cheapest set of prime implicants covering the rows
+// where a function is true, within a budget of search nodes
+type coverSearch struct {
+	// covers holds, for each prime, the required rows it covers
+	covers []bitset
+	// literals is the number of literals of each prime
+	literals []int
+	rows     int
+	best     formCost
+	nodes    int
+}
+
+// minimalCover returns the cost of the cheapest set of prime implicants
+// covering every row where the function is true. It fails once the search
+// has visited maxCoverNodes nodes.
+func minimalCover(n int, ones, dontCares []bool) (formCost, error) {
+	var required []int
+	for row := 0; row < 1<<n; row++ {
+		if ones[row] {
+			required = append(required, row)
+		}
+	}
+	c := &coverSearch{rows: len(required), best: formCost{Terms: len(required) + 1}}
+	for _, term := range primeImplicants(n, ones, dontCares) {
+		covers := newBitset(len(required))
+		for i, row := range required {
+			if row&^term.mask == term.value {
+				covers.add(i)
+			}
+		}
+		c.covers = append(c.covers, covers)
+		c.literals = append(c.literals, n-bits.OnesCount(uint(term.mask)))
+	}
+
+	uncovered := newBitset(len(required))
+	for i := range required {
+		uncovered.add(i)
+	}
+	active := make([]bool, len(c.covers))
+	for i := range active {
+		active[i] = true
+	}
+	if !c.search(uncovered, active, formCost{}) {
+		return formCost{}, fmt.Errorf("function is too complex to minimize: gave up after %d search nodes", maxCoverNodes)
+	}
+	return c.best, nil
+}
+
+// search covers the uncovered rows with the active primes, on top of a
+// partial cover of the given cost. It first takes essential primes and drops
+// dominated primes and rows, then branches on the row with the fewest
+// primes covering it. It reports false when the budget runs out.
+func (c *coverSearch) search(uncovered bitset, active []bool, cost formCost) bool {
+	if c.nodes++; c.nodes > maxCoverNodes {
+		return false
+	}
+	active = append([]bool(nil), active...)
+	for {
+		if uncovered.empty() {
+			if cost.less(c.best) {
+				c.best = cost
+			}
+			return true
+		}
+		// Covering the rest takes at least one more term
+		if !(formCost{Terms: cost.Terms + 1, Literals: cost.Literals}).less(c.best) {
+			return true
+		}
+
+		// primesOf lists the active primes covering each uncovered row
+		primesOf := make([]bitset, c.rows)
+		for row := 0; row < c.rows; row++ {
+			if !uncovered.has(row) {
+				continue
+			}
+			primes := newBitset(len(c.covers))
+			for p, ok := range active {
+				if ok && c.covers[p].has(row) {
+					primes.add(p)
+				}
+			}
+			if primes.empty() {
+				return true
+			}
+			primesOf[row] = primes
+		}
+
+		if p, ok := c.essential(primesOf); ok {
+			uncovered = uncovered.minus(c.covers[p])
+			active[p] = false
+			cost = formCost{Terms: cost.Terms + 1, Literals: cost.Literals + c.literals[p]}
+			continue
+		}
+		changed := c.dropDominatedPrimes(uncovered, active)
+		if row, ok := dominatedRow(primesOf); ok {
+			uncovered = uncovered.without(row)
+			changed = true
+		}
+		if !changed {
+			break
+		}
+	}
+
+	// Branch on the row with the fewest primes; once a prime has been tried,
+	// later branches need not use it
+	pick, options := -1, 0
+	for row := 0; row < c.rows; row++ {
+		if !uncovered.has(row) {
+			continue
+		}
+		count := 0
+		for p, ok := range active {
+			if ok && c.covers[p].has(row) {
+				count++
+			}
+		}
+		if pick < 0 || count < options {
+			pick, options = row, count
+		}
+	}
+	for p, ok := range active {
+		if !ok || !c.covers[p].has(pick) {
+			continue
+		}
+		active[p] = false
+		next := formCost{Terms: cost.Terms + 1, Literals: cost.Literals + c.literals[p]}
+		if !c.search(uncovered.minus(c.covers[p]), active, next) {
+			return false
+		}
+	}
+	return true
+}
+
+// essential returns a prime that is the only one covering some row
+func (c *coverSearch) essential(primesOf []bitset) (int, bool) {
+	for _, primes := range primesOf {
+		if primes == nil {
+			continue
+		}
+		only := -1
+		for p := range c.covers {
+			if primes.has(p) {
+				if only >= 0 {
+					only = -2
+					break
+				}
+				only = p
+			}
+		}
+		if only >= 0 {
+			return only, true
+		}
+	}
+	return 0, false
+}
+
+// dropDominatedPrimes deactivates each prime that covers no uncovered row
+// outside those of another prime with no more literals, telling whether it dropped any
+func (c *coverSearch) dropDominatedPrimes(uncovered bitset, active []bool) bool {
+	live := make([]bitset, len(c.covers))
+	for p, ok := range active {
+		if ok {
+			live[p] = c.covers[p].and(uncovered)
+		}
+	}
+	dropped := false
+	for p, ok := range active {
+		if !ok {
+			continue
+		}
+		for q, other := range active {
+			if q == p || !other || c.literals[q] > c.literals[p] || !live[p].subsetOf(live[q]) {
+				continue
+			}
+			// Of two primes covering the same rows at the same cost, keep the first
+			if c.literals[q] == c.literals[p] && q > p && live[q].subsetOf(live[p]) {
+				continue
+			}
+			active[p] = false
+			dropped = true
+			break
+		}
+	}
+	return dropped
+}
+
+// dominatedRow returns a row that every prime covering some other row also
+// covers, so that covering the other row covers it too
+func dominatedRow(primesOf []bitset) (int, bool) {
+	for row, primes := range primesOf {
+		if primes == nil {
+			continue
+		}
+		for other, otherPrimes := range primesOf {
+			if other == row || otherPrimes == nil || !otherPrimes.subsetOf(primes) {
+				continue
+			}
+			// Of two rows covered by the same primes, keep the lower one
+			if primes.subsetOf(otherPrimes) && other > row {
+				continue
+			}
+			return row, true
+		}
+	}
+	return 0, false
+}
+
+// normalFormCost measures an expression as a sum of products or a product
+// of sums, telling whether it has that form at all. A lone literal or
+// product counts as a sum of products, a lone literal or sum as a product of
+// sums; TRUE is the empty product and FALSE the empty sum.
+func normalFormCost(expr *boolExpr, form string) (formCost, bool) {
+	outer, inner := opOr, opAnd
+	if form == formPOS {
+		outer, inner = opAnd, opOr
+	}
+
+	if expr.Op == opConstant {
+		// TRUE is one empty term of a sum of products and no clauses of a product of sums
+		if expr.Value == (form == formSOP) {
+			return formCost{Terms: 1}, true
+		}
+		return formCost{}, true
+	}
+
+	cost := formCost{}
+	for _, term := range flattenOp(expr, outer) {
+		cost.Terms++
+		for _, literal := range flattenOp(term, inner) {
+			if literal.Op == opNot {
+				literal = literal.Operands[0]
+			}
+			if literal.Op != opVariable {
+				return formCost{}, false
+			}
+			cost.Literals++
+		}
+	}
+	return cost, true
+}
+
+// flattenOp returns the operands of a chain of the same operator
+func flattenOp(expr *boolExpr, op string) []*boolExpr {
+	if expr.Op != op {
+		return []*boolExpr{expr}
+	}
+	var operands []*boolExpr
+	for _, operand := range expr.Operands {
+		operands = append(operands, flattenOp(operand, op)...)
+	}
+	return operands
+}
+
+// formName names a normal form for messages
+func formName(form string) string {
+	if form == formPOS {
+		return "product of sums"
+	}
+	return "sum of products"
+}
+
+// verifyMinimization checks that a submitted expression is equivalent to
+// the target function and as small as its minimal sum of products or
+// product of sums
+func verifyMinimization(result PuzzleVerificationResult, spec MinimizeSpec, src string) PuzzleVerificationResult {
+	if src == "" {
+		result.Message = "Expression is missing"
+		return result
+	}
+	expr, err := ParseBoolExpr(src)
+	if err != nil {
+		result.Message = fmt.Sprintf("Invalid expression: %v", err)
+		return result
+	}
+	for _, variable := range expr.Variables() {
+		if !containsString(spec.Variables, variable) {
+			result.Message = fmt.Sprintf("'%s' is not a variable of this puzzle", variable)
+			return result
+		}
+	}
+
+	forms := spec.forms()
+	costs := make(map[string]formCost)
+	for _, form := range forms {
+		if cost, ok := normalFormCost(expr, form); ok {
+			costs[form] = cost
+		}
+	}
+	if len(costs) == 0 {
+		if spec.Form != "" {
+			result.Message = fmt.Sprintf("Expression is not a %s", formName(spec.Form))
+		} else {
+			result.Message = "Expression is neither a sum of products nor a product of sums"
+		}
+		return result
+	}
+
+	ones, dontCares, err := spec.truthTable()
+	if err != nil {
+		result.Message = fmt.Sprintf("Failed to parse target function: %v", err)
+		return result
+	}
+
+	// Check equivalence first, so a wrong answer gets its counterexample
+	// without a search for the minimum, which loaded puzzles already know
+	report := &MinimizationResult{Equivalent: true}
+	result.Minimization = report
+	for row, values := range inputRows(spec.Variables) {
+		if dontCares[row] {
+			continue
+		}
+		if actual := expr.Eval(values); actual != ones[row] {
+			measureMinimization(report, forms, costs, spec.minimal)
+			report.Equivalent, report.Minimal = false, false
+			report.Counterexample = &Counterexample{Inputs: values, Expected: ones[row], Actual: actual}
+			result.Message = fmt.Sprintf("Expression is not equivalent to the target function: for %s it gives %s instead of %s",
+				formatSignals(values), formatBit(actual), formatBit(ones[row]))
+			return result
+		}
+	}
+
+	minimalCosts, err := spec.minimalCosts()
+	if err != nil {
+		result.Message = fmt.Sprintf("Failed to minimize target function: %v", err)
+		return result
+	}
+	measureMinimization(report, forms, costs, minimalCosts)
+	if !report.Minimal {
+		result.Message = fmt.Sprintf("Expression is equivalent but not minimal: it has %s, where a minimal %s has %s",
+			formCost{report.Terms, report.Literals}, formName(report.Form), formCost{report.MinimalTerms, report.MinimalLiterals})
+		return result
+	}
+
+	result.Valid = true
+	result.Message = fmt.Sprintf("Expression is a minimal %s", formName(report.Form))
+	return result
+}
+
+// measureMinimization records the size of a submission in each form it
+// has, keeping a form in which it is minimal
+func measureMinimization(report *MinimizationResult, forms []string, costs, minimalCosts map[string]formCost) {
+	for _, form := range forms {
+		cost, ok := costs[form]
+		if !ok {
+			continue
+		}
+		minimal := minimalCosts[form]
+		if report.Form == "" || (!report.Minimal && !minimal.less(cost)) {
+			report.Form = form
+			report.Terms, report.Literals = cost.Terms, cost.Literals
+			report.MinimalTerms, report.MinimalLiterals = minimal.Terms, minimal.Literals
+			report.Minimal = !minimal.less(cost)
+		}
+	}
+}
+
+// formatBit formats a boolean as 0 or 1
+func formatBit(value bool) string {
+	if value {
+		return "1"
+	}
+	return "0"
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// maxPatternTerms bounds how far into its sequence a pattern puzzle may ask
+const maxPatternTerms = 10000
+
+// Kinds of pattern rules
+const (
+	ruleArithmetic  = "arithmetic"
+	ruleGeometric   = "geometric"
+	rulePolynomial  = "polynomial"
+	ruleRecurrence  = "recurrence"
+	ruleAlternating = "alternating"
+)
+
+// PatternRule generates the terms a_0, a_1, ... of a number sequence
+type PatternRule struct {
+	// Kind is one of:
+	//
+	//	arithmetic   a_n = first + n*difference
+	//	geometric    a_n = first * ratio^n
+	//	polynomial   a_n = c_0 + c_1*n + c_2*n^2 + ...
+	//	recurrence   a_n = c_0*a_(n-1) + c_1*a_(n-2) + ..., after the initial terms
+	//	alternating  the terms of each of the rules in turn
+	Kind       string `json:"kind"`
+	First      int    `json:"first,omitempty"`
+	Difference int    `json:"difference,omitempty"`
+	Ratio      int    `json:"ratio,omitempty"`
+	// Coefficients are the c_k of a polynomial or a recurrence
+	Coefficients []int `json:"coefficients,omitempty"`
+	// Initial are the first terms of a recurrence, one per coefficient
+	Initial []int `json:"initial,omitempty"`
+	// Rules are interleaved by an alternating rule: term n is term n/k of rule n%k
+	Rules []PatternRule `json:"rules,omitempty"`
+}
+
+// PatternSpec makes a pattern puzzle ask for terms generated by a rule
+// rather than a stored answer list
+type PatternSpec struct {
+	Rule PatternRule `json:"rule"`
+	// Offset is the index of the first term asked for, counting from 0
+	Offset int `json:"offset,omitempty"`
+	// Count is the number of terms asked for
+	Count int `json:"count"`
+}
+
+// PatternTerms returns the first n terms of a rule's sequence
+func PatternTerms(rule PatternRule, n int) ([]int, error) {
+	if n < 0 || n > maxPatternTerms {
+		return nil, fmt.Errorf("rules give at most %d terms", maxPatternTerms)
+	}
+	terms, err := ruleTerms(rule, n)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]int, n)
+	for i, term := range terms {
+		out[i] = int(term)
+	}
+	return out, nil
+}
+
+// ruleTerms computes the first n terms of a rule, failing on terms that overflow
+func ruleTerms(rule PatternRule, n int) ([]int64, error) {
+	terms := make([]int64, 0, n)
+	overflow := func(i int) error {
+		return fmt.Errorf("%s term %d is too large", rule.Kind, i)
+	}
+	switch rule.Kind {
+	case ruleArithmetic:
+		for i := 0; i < n; i++ {
+			step, ok := mulInt64(int64(i), int64(rule.Difference))
+			if !ok {
+				return nil, overflow(i)
+			}
+			term, ok := addInt64(int64(rule.First), step)
+			if !ok {
+				return nil, overflow(i)
+			}
+			terms = append(terms, term)
+		}
+	case ruleGeometric:
+		if rule.Ratio == 0 {
+			return nil, fmt.Errorf("geometric rules need a ratio other than 0")
+		}
+		term := int64(rule.First)
+		for i := 0; i < n; i++ {
+			if i > 0 {
+				var ok bool
+				if term, ok = mulInt64(term, int64(rule.Ratio)); !ok {
+					return nil, overflow(i)
+				}
+			}
+			terms = append(terms, term)
+		}
+	case rulePolynomial:
+		if len(rule.Coefficients) == 0 {
+			return nil, fmt.Errorf("polynomial rules need coefficients")
+		}
+		for i := 0; i < n; i++ {
+			// Horner's scheme, from the highest power down
+			term := int64(0)
+			for k := len(rule.Coefficients) - 1; k >= 0; k-- {
+				var ok bool
+				if term, ok = mulInt64(term, int64(i)); ok {
+					term, ok = addInt64(term, int64(rule.Coefficients[k]))
+				}
+				if !ok {
+					return nil, overflow(i)
+				}
+			}
+			terms = append(terms, term)
+		}
+	case ruleRecurrence:
+		if len(rule.Coefficients) == 0 || len(rule.Initial) != len(rule.Coefficients) {
+			return nil, fmt.Errorf("recurrence rules need coefficients and as many initial terms")
+		}
+		for i := 0; i < n; i++ {
+			if i < len(rule.Initial) {
+				terms = append(terms, int64(rule.Initial[i]))
+				continue
+			}
+			term := int64(0)
+			for k, c := range rule.Coefficients {
+				part, ok := mulInt64(int64(c), terms[i-1-k])
+				if ok {
+					term, ok = addInt64(term, part)
+				}
+				if !ok {
+					return nil, overflow(i)
+				}
+			}
+			terms = append(terms, term)
+		}
+	case ruleAlternating:
+		if len(rule.Rules) < 2 {
+			return nil, fmt.Errorf("alternating rules need at least two rules")
+		}
+		k := len(rule.Rules)
+		interleaved := make([][]int64, k)
+		for j, sub := range rule.Rules {
+			var err error
+			if interleaved[j], err = ruleTerms(sub, (n-j+k-1)/k); err != nil {
+				return nil, err
+			}
+		}
+		for i := 0; i < n; i++ {
+			terms = append(terms, interleaved[i%k][i/k])
+		}
+	default:
+		return nil, fmt.Errorf("unknown rule kind '%s'", rule.Kind)
+	}
+	return terms, nil
+}
+
+// addInt64 adds two numbers, reporting false when the sum overflows
+func addInt64(a, b int64) (int64, bool) {
+	if (b > 0 && a > math.MaxInt64-b) || (b < 0 && a < math.MinInt64-b) {
+		return 0, false
+	}
+	return a + b, true
+}
+
+// mulInt64 multiplies two numbers, reporting false when the product overflows
+func mulInt64(a, b int64) (int64, bool) {
+	if a == 0 || b == 0 {
+		return 0, true
+	}
+	product := a * b
+	if product/b != a || (a == -1 && b == math.MinInt64) || (b == -1 && a == math.MinInt64) {
+		return 0, false
+	}
+	return product, true
+}
+
+// expandPatternRule checks the rule of a pattern puzzle and stores the
+// terms it asks for as the solution. A stored solution must match them.
+func expandPatternRule(puzzle *Puzzle) error {
+	spec := puzzle.Pattern
+	if spec == nil {
+		return nil
+	}
+	if puzzle.Type != TypePattern {
+		return fmt.Errorf("only pattern puzzles have a rule")
+	}
+	if spec.Offset < 0 || spec.Count < 1 {
+		return fmt.Errorf("offset must not be negative and count must be at least 1")
+	}
+	terms, err := PatternTerms(spec.Rule, spec.Offset+spec.Count)
+	if err != nil {
+		return err
+	}
+	if len(puzzle.Solution) > 0 && string(puzzle.Solution) != "null" {
+		var stored PatternSolution
+		if err := json.Unmarshal(puzzle.Solution, &stored); err != nil {
+			return fmt.Errorf("failed to parse stored solution: %v", err)
+		}
+		check := verifyPatternTerms(PuzzleVerificationResult{}, terms[spec.Offset:], stored.Sequence, spec.Offset)
+		if !check.Valid {
+			return fmt.Errorf("stored solution does not match the rule: %s", strings.ToLower(check.Message[:1])+check.Message[1:])
+		}
+	}
+	solution, err := json.Marshal(PatternSolution{Sequence: terms[spec.Offset:]})
+	if err != nil {
+		return err
+	}
+	puzzle.Solution = solution
+	return nil
+}
+
+// verifyPatternTerms compares submitted terms with the expected ones, the
+// first of which is term offset of the sequence, and reports the index in
+// the sequence of the first wrong or missing term
+func verifyPatternTerms(result PuzzleVerificationResult, expected, submitted []int, offset int) PuzzleVerificationResult {
+	wrong := func(i int) *int {
+		index := offset + i
+		return &index
+	}
+	for i := 0; i < len(expected) && i < len(submitted); i++ {
+		if submitted[i] != expected[i] {
+			result.FirstWrongTerm = wrong(i)
+			result.Message = fmt.Sprintf("Term %d is wrong", *result.FirstWrongTerm)
+			return result
+		}
+	}
+	if len(submitted) != len(expected) {
+		result.FirstWrongTerm = wrong(len(submitted))
+		if len(submitted) > len(expected) {
+			result.FirstWrongTerm = wrong(len(expected))
+		}
+		result.Message = fmt.Sprintf("Sequence has %d terms, expected %d", len(submitted), len(expected))
+		return result
+	}
+
+	result.Valid = true
+	result.Message = "Pattern solution is correct"
+	return result
+}
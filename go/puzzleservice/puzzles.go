@@ -11,12 +11,28 @@ import (
 
 // Puzzle represents a puzzle definition
 type Puzzle struct {
-	ID          string          `json:"id"`
-	Type        PuzzleType      `json:"type"`
-	Name        string          `json:"name"`
-	Description string          `json:"description"`
-	Difficulty  string          `json:"difficulty"`
-	Solution    json.RawMessage `json:"solution"`
+	ID             string               `json:"id"`
+	Type           PuzzleType           `json:"type"`
+	Name           string               `json:"name"`
+	Description    string               `json:"description"`
+	Difficulty     string               `json:"difficulty"`
+	Components     []Component          `json:"components,omitempty"`
+	Goals          []CircuitScenario    `json:"goals,omitempty"`
+	Transient      *TransientAnalysis   `json:"transient,omitempty"`
+	Expression     string               `json:"expression,omitempty"`
+	UniqueSolution bool                 `json:"uniqueSolution,omitempty"`
+	LogicCircuit   *LogicCircuitSpec    `json:"logicCircuit,omitempty"`
+	Sequential     *SequentialSpec      `json:"sequential,omitempty"`
+	Minimize       *MinimizeSpec        `json:"minimize,omitempty"`
+	Maze           *MazeGrid            `json:"maze,omitempty"`
+	MaxExtraSteps  *int                 `json:"maxExtraSteps,omitempty"`
+	Generator      *MazeGenerator       `json:"generator,omitempty"`
+	Fog            *FogSpec             `json:"fog,omitempty"`
+	Rover          *RoverSpec           `json:"rover,omitempty"`
+	Pattern        *PatternSpec         `json:"pattern,omitempty"`
+	Variables      []ConstraintVariable `json:"variables,omitempty"`
+	Constraints    []Constraint         `json:"constraints,omitempty"`
+	Solution       json.RawMessage      `json:"solution"`
 }
 
 // PuzzleStore represents a store of puzzles
@@ -109,6 +125,51 @@ func (s *PuzzleStore) loadPuzzlesFromDir(dir string) error {
 			return fmt.Errorf("failed to parse puzzle file %s: %v", filePath, err)
 		}
 
+		if err := validateComponents(puzzle.Components); err != nil {
+			return fmt.Errorf("invalid components in puzzle file %s: %v", filePath, err)
+		}
+		if err := validateTransient(puzzle.Transient); err != nil {
+			return fmt.Errorf("invalid transient analysis in puzzle file %s: %v", filePath, err)
+		}
+		if puzzle.Expression != "" {
+			if _, err := ParseBoolExpr(puzzle.Expression); err != nil {
+				return fmt.Errorf("invalid expression in puzzle file %s: %v", filePath, err)
+			}
+		}
+		if err := validateUniqueSolution(puzzle); err != nil {
+			return fmt.Errorf("puzzle file %s does not have a unique solution: %v", filePath, err)
+		}
+		if err := validateLogicCircuit(puzzle.LogicCircuit); err != nil {
+			return fmt.Errorf("invalid logic circuit in puzzle file %s: %v", filePath, err)
+		}
+		if err := validateSequential(puzzle.Sequential); err != nil {
+			return fmt.Errorf("invalid sequential logic in puzzle file %s: %v", filePath, err)
+		}
+		if err := validateMinimize(puzzle.Minimize); err != nil {
+			return fmt.Errorf("invalid minimization in puzzle file %s: %v", filePath, err)
+		}
+		if err := expandMazeGenerator(&puzzle); err != nil {
+			return fmt.Errorf("invalid maze generator in puzzle file %s: %v", filePath, err)
+		}
+		if err := validateMaze(puzzle.Maze); err != nil {
+			return fmt.Errorf("invalid maze in puzzle file %s: %v", filePath, err)
+		}
+		if puzzle.MaxExtraSteps != nil && (puzzle.Maze == nil || len(puzzle.Maze.Agents) > 0 || *puzzle.MaxExtraSteps < 0) {
+			return fmt.Errorf("invalid maze in puzzle file %s: maxExtraSteps needs a maze grid without agents and must not be negative", filePath)
+		}
+		if err := validateRover(puzzle); err != nil {
+			return fmt.Errorf("invalid rover in puzzle file %s: %v", filePath, err)
+		}
+		if err := validateFog(puzzle); err != nil {
+			return fmt.Errorf("invalid fog in puzzle file %s: %v", filePath, err)
+		}
+		if err := expandPatternRule(&puzzle); err != nil {
+			return fmt.Errorf("invalid pattern rule in puzzle file %s: %v", filePath, err)
+		}
+		if err := validateConstraints(puzzle.Variables, puzzle.Constraints); err != nil {
+			return fmt.Errorf("invalid constraints in puzzle file %s: %v", filePath, err)
+		}
+
 		// Add the puzzle to the store
 		s.puzzles[puzzle.ID] = puzzle
 		fmt.Printf("Loaded puzzle: %s (%s)\n", puzzle.ID, puzzle.Name)
@@ -189,7 +250,13 @@ func (s *PuzzleStore) LoadPredefinedPuzzles() error {
 		Name:        "Simple LED Circuit",
 		Description: "Create a circuit that powers an LED with a battery, switch, and resistor",
 		Difficulty:  "Easy",
-		Solution:    circuit1SolutionJSON,
+		Components: []Component{
+			{ID: "battery", Kind: KindBattery, Voltage: 9.0},
+			{ID: "switch", Kind: KindSwitch},
+			{ID: "led", Kind: KindLED, ForwardVoltage: 2.0, MaxCurrent: 0.02},
+			{ID: "resistor", Kind: KindResistor, Resistance: 470.0},
+		},
+		Solution: circuit1SolutionJSON,
 	}
 
 	s.puzzles["logic1"] = Puzzle{
@@ -198,6 +265,7 @@ func (s *PuzzleStore) LoadPredefinedPuzzles() error {
 		Name:        "Basic Logic Gates",
 		Description: "Set the values of A, B, and C to satisfy the condition: (A AND B) AND (NOT C)",
 		Difficulty:  "Easy",
+		Expression:  "(A AND B) AND (NOT C)",
 		Solution:    logic1SolutionJSON,
 	}
 
@@ -261,6 +329,10 @@ func (s *PuzzleStore) VerifyPuzzleSolution(solution PuzzleSolution) PuzzleVerifi
 		return s.verifyMazeSolution(puzzle, solution)
 	case TypePattern:
 		return s.verifyPatternSolution(puzzle, solution)
+	case TypeConstraint:
+		return s.verifyConstraintSolution(puzzle, solution)
+	case TypeRover:
+		return s.verifyRoverSolution(puzzle, solution)
 	default:
 		result.Message = fmt.Sprintf("Unknown puzzle type: %s", puzzle.Type)
 		return result
@@ -286,94 +358,112 @@ func (s *PuzzleStore) verifyCircuitSolution(puzzle Puzzle, solution PuzzleSoluti
 		return result
 	}
 
-	// Verify connections
-	if !verifyConnections(submittedSolution.Connections, correctSolution.Connections) {
-		result.Message = "Circuit connections are incorrect"
+	// Every submitted component must come from the parts bin, or have a
+	// known kind for puzzles without one
+	parts := circuitParts(puzzle.Components)
+	if unknown := unknownComponents(submittedSolution.Connections, parts); len(unknown) > 0 {
+		result.Message = fmt.Sprintf("Components are not part of this puzzle: %s", strings.Join(unknown, ", "))
+		result.Diagnostics = &CircuitDiagnostics{UnknownComponents: unknown}
 		return result
 	}
 
-	// Verify power states
-	if !verifyPowerStates(submittedSolution.PowerState, correctSolution.PowerState) {
-		result.Message = "Circuit power states are incorrect"
+	// Simulate both circuits so the power states come from the wiring itself
+	correctNetlist, correctPoint, err := simulateCircuit(correctSolution.Connections, parts)
+	if err != nil {
+		result.Message = fmt.Sprintf("Failed to simulate stored solution: %v", err)
 		return result
 	}
 
-	result.Valid = true
-	result.Message = "Circuit solution is correct"
-	return result
-}
-
-// verifyConnections verifies that the submitted connections match the correct ones
-func verifyConnections(submitted, correct []Connection) bool {
-	if len(submitted) != len(correct) {
-		return false
+	connections := orientConnections(submittedSolution.Connections, parts, correctNetlist)
+	submittedNetlist, submittedPoint, err := simulateCircuit(connections, parts)
+	if err != nil {
+		result.Message = fmt.Sprintf("Failed to simulate circuit: %v", err)
+		return result
 	}
 
-	// Create maps for easier comparison
-	submittedMap := make(map[string]string)
-	correctMap := make(map[string]string)
+	result.PowerState = submittedPoint.PowerStates()
+	result.Hazards = detectHazards(submittedNetlist, submittedPoint)
+	diagnostics := diagnoseCircuit(submittedNetlist, correctNetlist, submittedPoint, correctPoint)
 
-	for _, conn := range submitted {
-		// Normalize the connection direction
-		if conn.From > conn.To {
-			conn.From, conn.To = conn.To, conn.From
-		}
-		key := conn.From + "-" + conn.To
-		submittedMap[key] = key
+	// Every pin of a placed component must be wired
+	if len(submittedNetlist.Unconnected) > 0 {
+		result.Message = fmt.Sprintf("Pins are not connected: %s", strings.Join(submittedNetlist.Unconnected, ", "))
+		result.Diagnostics = diagnostics
+		return result
 	}
 
-	for _, conn := range correct {
-		// Normalize the connection direction
-		if conn.From > conn.To {
-			conn.From, conn.To = conn.To, conn.From
+	// Goal-based and transient puzzles accept any wiring that meets every
+	// scenario and waveform assertion; the diagnostics of a failure still
+	// compare it with the stored wiring
+	if len(puzzle.Goals) > 0 {
+		result = verifyCircuitGoals(result, puzzle.Goals, submittedNetlist)
+		if !result.Valid {
+			result.Diagnostics = diagnostics
+			return result
 		}
-		key := conn.From + "-" + conn.To
-		correctMap[key] = key
-	}
-
-	// Check if all correct connections are in the submitted solution
-	for key := range correctMap {
-		if _, ok := submittedMap[key]; !ok {
-			return false
+		if puzzle.Transient == nil {
+			return result
 		}
+		result.Valid = false
 	}
-
-	// Check if all submitted connections are in the correct solution
-	for key := range submittedMap {
-		if _, ok := correctMap[key]; !ok {
-			return false
+	if puzzle.Transient != nil {
+		result = verifyCircuitTransient(result, *puzzle.Transient, submittedNetlist)
+		if !result.Valid {
+			result.Diagnostics = diagnostics
 		}
+		return result
 	}
 
-	return true
-}
-
-// verifyPowerStates verifies that the submitted power states match the correct ones
-func verifyPowerStates(submitted, correct []PowerState) bool {
-	if len(submitted) != len(correct) {
-		return false
+	// LEDs must face the same way as in the stored circuit. Submitted LEDs are
+	// compared as the stored LEDs they map onto; wiring that does not match
+	// has no mapping, so there only reversing more LEDs than the stored one counts.
+	mapping, matched := matchCircuits(submittedNetlist, correctNetlist)
+	correctReversed := reversedLEDs(correctNetlist, correctPoint)
+	submittedReversed := reversedLEDs(submittedNetlist, submittedPoint)
+	for _, id := range submittedReversed {
+		wrong := len(submittedReversed) > len(correctReversed)
+		if matched {
+			wrong = !containsString(correctReversed, mapping[id])
+		}
+		if wrong {
+			result.Message = fmt.Sprintf("LED '%s' is wired with reversed polarity", id)
+			result.Diagnostics = diagnostics
+			return result
+		}
 	}
 
-	// Create maps for easier comparison
-	submittedMap := make(map[string]bool)
-	correctMap := make(map[string]bool)
-
-	for _, state := range submitted {
-		submittedMap[state.ComponentID] = state.Powered
+	// The circuit must be safe to build
+	if len(result.Hazards) > 0 {
+		result.Message = fmt.Sprintf("Circuit is unsafe: %s", result.Hazards[0].Message)
+		result.Diagnostics = diagnostics
+		return result
 	}
 
-	for _, state := range correct {
-		correctMap[state.ComponentID] = state.Powered
+	// The wiring must be equivalent to the stored one, up to the order of
+	// series elements, parallel branches and interchangeable parts
+	if !matched {
+		result.Message = "Circuit topology does not match the puzzle"
+		result.Diagnostics = diagnostics
+		if summary := result.Diagnostics.summary(); summary != "" {
+			result.Message += ": " + summary
+		}
+		return result
 	}
+	result.Mapping = mapping
 
-	// Check if all component power states match
-	for id, powered := range correctMap {
-		if submittedPowered, ok := submittedMap[id]; !ok || submittedPowered != powered {
-			return false
+	// The submitted circuit must behave like the stored one
+	renamedPoint := submittedPoint.renamed(mapping)
+	if mismatch := compareOperatingPoints(renamedPoint, correctPoint, correctNetlist); mismatch != "" {
+		result.Message = fmt.Sprintf("Circuit power states are incorrect: %s", mismatch)
+		result.Diagnostics = &CircuitDiagnostics{
+			PowerStateMismatches: diagnosePowerStates(renamedPoint, correctPoint, correctNetlist),
 		}
+		return result
 	}
 
-	return true
+	result.Valid = true
+	result.Message = "Circuit solution is correct"
+	return result
 }
 
 // verifyLogicSolution verifies a logic puzzle solution
@@ -389,6 +479,31 @@ func (s *PuzzleStore) verifyLogicSolution(puzzle Puzzle, solution PuzzleSolution
 		return result
 	}
 
+	// Gate puzzles check the submitted network against every input combination
+	if puzzle.LogicCircuit != nil {
+		return verifyLogicCircuit(result, *puzzle.LogicCircuit, submittedSolution)
+	}
+
+	// Sequential puzzles simulate the submitted network cycle by cycle
+	if puzzle.Sequential != nil {
+		return verifySequentialCircuit(result, *puzzle.Sequential, submittedSolution)
+	}
+
+	// Minimization puzzles check the submitted expression for equivalence and size
+	if puzzle.Minimize != nil {
+		return verifyMinimization(result, *puzzle.Minimize, submittedSolution.Expression)
+	}
+
+	// Puzzles with an expression accept every assignment that satisfies it
+	if puzzle.Expression != "" {
+		expr, err := ParseBoolExpr(puzzle.Expression)
+		if err != nil {
+			result.Message = fmt.Sprintf("Failed to parse puzzle expression: %v", err)
+			return result
+		}
+		return verifyLogicExpression(result, expr, submittedSolution.Values)
+	}
+
 	var correctSolution LogicSolution
 	if err := json.Unmarshal(puzzle.Solution, &correctSolution); err != nil {
 		result.Message = fmt.Sprintf("Failed to parse stored solution: %v", err)
@@ -409,6 +524,42 @@ func (s *PuzzleStore) verifyLogicSolution(puzzle Puzzle, solution PuzzleSolution
 	return result
 }
 
+// verifyConstraintSolution verifies a constraint puzzle solution
+func (s *PuzzleStore) verifyConstraintSolution(puzzle Puzzle, solution PuzzleSolution) PuzzleVerificationResult {
+	result := PuzzleVerificationResult{
+		PuzzleID: solution.PuzzleID,
+		Valid:    false,
+	}
+
+	var submittedSolution ConstraintSolution
+	if err := json.Unmarshal(solution.Solution, &submittedSolution); err != nil {
+		result.Message = fmt.Sprintf("Invalid constraint solution format: %v", err)
+		return result
+	}
+
+	return verifyConstraints(result, puzzle.Variables, puzzle.Constraints, submittedSolution.Values)
+}
+
+// verifyRoverSolution verifies a rover puzzle solution
+func (s *PuzzleStore) verifyRoverSolution(puzzle Puzzle, solution PuzzleSolution) PuzzleVerificationResult {
+	result := PuzzleVerificationResult{
+		PuzzleID: solution.PuzzleID,
+		Valid:    false,
+	}
+
+	var submittedSolution RoverSolution
+	if err := json.Unmarshal(solution.Solution, &submittedSolution); err != nil {
+		result.Message = fmt.Sprintf("Invalid rover solution format: %v", err)
+		return result
+	}
+
+	spec := RoverSpec{}
+	if puzzle.Rover != nil {
+		spec = *puzzle.Rover
+	}
+	return verifyRoverProgram(result, *puzzle.Maze, spec, submittedSolution.Program)
+}
+
 // verifyMazeSolution verifies a maze puzzle solution
 func (s *PuzzleStore) verifyMazeSolution(puzzle Puzzle, solution PuzzleSolution) PuzzleVerificationResult {
 	result := PuzzleVerificationResult{
@@ -422,6 +573,16 @@ func (s *PuzzleStore) verifyMazeSolution(puzzle Puzzle, solution PuzzleSolution)
 		return result
 	}
 
+	// Mazes with agents check a timed path for each agent and their collisions
+	if puzzle.Maze != nil && len(puzzle.Maze.Agents) > 0 {
+		return verifyAgentPaths(result, *puzzle.Maze, submittedSolution.Paths)
+	}
+
+	// Mazes with a grid check the path against the walls and blocked cells
+	if puzzle.Maze != nil {
+		return verifyMazePath(result, *puzzle.Maze, submittedSolution.Path, puzzle.MaxExtraSteps)
+	}
+
 	var correctSolution MazeSolution
 	if err := json.Unmarshal(puzzle.Solution, &correctSolution); err != nil {
 		result.Message = fmt.Sprintf("Failed to parse stored solution: %v", err)
@@ -491,20 +652,20 @@ func (s *PuzzleStore) verifyPatternSolution(puzzle Puzzle, solution PuzzleSoluti
 		return result
 	}
 
-	// Check if the sequences match
-	if len(submittedSolution.Sequence) != len(correctSolution.Sequence) {
-		result.Message = "Sequence has incorrect length"
-		return result
+	// Puzzles with a rule store the terms they ask for, starting at their offset
+	offset := 0
+	if puzzle.Pattern != nil {
+		offset = puzzle.Pattern.Offset
 	}
+	return verifyPatternTerms(result, correctSolution.Sequence, submittedSolution.Sequence, offset)
+}
 
-	for i, v := range correctSolution.Sequence {
-		if submittedSolution.Sequence[i] != v {
-			result.Message = "Sequence does not match the expected pattern"
-			return result
+// containsString reports whether list contains s
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
 		}
 	}
-
-	result.Valid = true
-	result.Message = "Pattern solution is correct"
-	return result
+	return false
 }
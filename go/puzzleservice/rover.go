@@ -0,0 +1,391 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Limits of rover programs
+const (
+	// defaultRoverSteps is the step budget of puzzles that do not set one
+	defaultRoverSteps = 500
+	// maxRoverSteps bounds the step budget a puzzle may set
+	maxRoverSteps = 100000
+)
+
+// Rover commands
+const (
+	roverForward = "forward"
+	roverTurn    = "turn"
+	roverRepeat  = "repeat"
+	roverIf      = "if"
+)
+
+// RoverSpec sets up the rover of a rover puzzle, which drives through the puzzle's maze
+type RoverSpec struct {
+	// Heading is the direction the rover faces at the start, east unless given
+	Heading string `json:"heading,omitempty"`
+	// MaxSteps is the step budget: the number of commands the rover may
+	// execute, counting every cell driven forward, every turn, every check
+	// of an if and every repetition of a repeat
+	MaxSteps int `json:"maxSteps,omitempty"`
+}
+
+// RoverSolution represents a solution for a rover puzzle: a program in the rover language
+type RoverSolution struct {
+	Program string `json:"program"`
+}
+
+// roverCommand is a parsed command of a rover program
+type roverCommand struct {
+	Op   string
+	Line int
+	// Count is the number of cells of forward and of repetitions of repeat
+	Count int
+	// Right turns right instead of left
+	Right bool
+	// Negate tests "if not wall ahead"
+	Negate bool
+	// Body runs under repeat and when an if holds, Else when it does not
+	Body, Else []roverCommand
+}
+
+// roverToken is a word or brace of a rover program and the line it is on
+type roverToken struct {
+	Text string
+	Line int
+}
+
+// tokenizeRover splits a program into lowercase words and braces, dropping
+// '#' comments and the ';' that may separate commands
+func tokenizeRover(program string) []roverToken {
+	var tokens []roverToken
+	for i, line := range strings.Split(program, "\n") {
+		if hash := strings.Index(line, "#"); hash >= 0 {
+			line = line[:hash]
+		}
+		line = strings.NewReplacer("{", " { ", "}", " } ", ";", " ").Replace(line)
+		for _, word := range strings.FieldsFunc(line, unicode.IsSpace) {
+			tokens = append(tokens, roverToken{Text: strings.ToLower(word), Line: i + 1})
+		}
+	}
+	return tokens
+}
+
+// roverParser reads rover commands from tokens
+type roverParser struct {
+	tokens []roverToken
+	pos    int
+}
+
+// ParseRoverProgram parses a rover program:
+//
+//	forward [N]                      drive N cells ahead, 1 unless given
+//	turn left | turn right           turn to the next direction of the maze's topology
+//	repeat N { ... }                 run the commands N times
+//	if [not] wall ahead { ... } [else { ... }]
+func ParseRoverProgram(program string) ([]roverCommand, error) {
+	p := &roverParser{tokens: tokenizeRover(program)}
+	commands, err := p.block(false)
+	if err != nil {
+		return nil, err
+	}
+	if len(commands) == 0 {
+		return nil, fmt.Errorf("program has no commands")
+	}
+	return commands, nil
+}
+
+// peek returns the next token, or an empty one at the end of the program
+func (p *roverParser) peek() roverToken {
+	if p.pos >= len(p.tokens) {
+		line := 0
+		if len(p.tokens) > 0 {
+			line = p.tokens[len(p.tokens)-1].Line
+		}
+		return roverToken{Line: line}
+	}
+	return p.tokens[p.pos]
+}
+
+// next consumes the next token
+func (p *roverParser) next() roverToken {
+	token := p.peek()
+	p.pos++
+	return token
+}
+
+// expect consumes a given word or fails
+func (p *roverParser) expect(word string) error {
+	if token := p.next(); token.Text != word {
+		return fmt.Errorf("line %d: expected '%s', found %s", token.Line, word, describeRoverToken(token))
+	}
+	return nil
+}
+
+// number consumes a positive number
+func (p *roverParser) number(after string) (int, error) {
+	token := p.next()
+	n, err := strconv.Atoi(token.Text)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("line %d: expected a positive number after '%s', found %s", token.Line, after, describeRoverToken(token))
+	}
+	return n, nil
+}
+
+// describeRoverToken names a token for error messages
+func describeRoverToken(token roverToken) string {
+	if token.Text == "" {
+		return "the end of the program"
+	}
+	return fmt.Sprintf("'%s'", token.Text)
+}
+
+// block parses commands up to the end of the program, or up to the closing brace of a block
+func (p *roverParser) block(braced bool) ([]roverCommand, error) {
+	var commands []roverCommand
+	for {
+		token := p.peek()
+		switch {
+		case token.Text == "" && !braced:
+			return commands, nil
+		case token.Text == "" && braced:
+			return nil, fmt.Errorf("line %d: missing '}'", token.Line)
+		case token.Text == "}" && braced:
+			p.next()
+			return commands, nil
+		}
+		command, err := p.command()
+		if err != nil {
+			return nil, err
+		}
+		commands = append(commands, command)
+	}
+}
+
+// braced parses a block between braces, which must hold at least one command
+func (p *roverParser) braced() ([]roverCommand, error) {
+	open := p.peek()
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	commands, err := p.block(true)
+	if err == nil && len(commands) == 0 {
+		return nil, fmt.Errorf("line %d: empty block", open.Line)
+	}
+	return commands, err
+}
+
+// command parses a single command
+func (p *roverParser) command() (roverCommand, error) {
+	token := p.next()
+	command := roverCommand{Op: token.Text, Line: token.Line}
+	var err error
+	switch token.Text {
+	case roverForward:
+		command.Count = 1
+		if _, convErr := strconv.Atoi(p.peek().Text); convErr == nil {
+			command.Count, err = p.number(roverForward)
+		}
+	case roverTurn:
+		switch direction := p.next(); direction.Text {
+		case "left":
+		case "right":
+			command.Right = true
+		default:
+			err = fmt.Errorf("line %d: expected 'left' or 'right' after 'turn', found %s", direction.Line, describeRoverToken(direction))
+		}
+	case roverRepeat:
+		if command.Count, err = p.number(roverRepeat); err == nil {
+			command.Body, err = p.braced()
+		}
+	case roverIf:
+		if p.peek().Text == "not" {
+			p.next()
+			command.Negate = true
+		}
+		if err = p.expect("wall"); err == nil {
+			err = p.expect("ahead")
+		}
+		if err == nil {
+			command.Body, err = p.braced()
+		}
+		if err == nil && p.peek().Text == "else" {
+			p.next()
+			command.Else, err = p.braced()
+		}
+	default:
+		err = fmt.Errorf("line %d: unknown command %s", token.Line, describeRoverToken(token))
+	}
+	return command, err
+}
+
+// validateRover checks the rover of a rover puzzle against its maze
+func validateRover(puzzle Puzzle) error {
+	if puzzle.Type != TypeRover {
+		if puzzle.Rover != nil {
+			return fmt.Errorf("only rover puzzles have a rover")
+		}
+		return nil
+	}
+	if puzzle.Maze == nil || len(puzzle.Maze.Agents) > 0 {
+		return fmt.Errorf("rover puzzles need a maze grid without agents")
+	}
+	spec := RoverSpec{}
+	if puzzle.Rover != nil {
+		spec = *puzzle.Rover
+	}
+	if spec.Heading != "" && !containsString(puzzle.Maze.topology().directions(), spec.Heading) {
+		return fmt.Errorf("unknown heading '%s'", spec.Heading)
+	}
+	if spec.MaxSteps < 0 || spec.MaxSteps > maxRoverSteps {
+		return fmt.Errorf("maxSteps must be between 0 and %d", maxRoverSteps)
+	}
+	return nil
+}
+
+// roverRun executes a program on a maze, recording the cells the rover drives through
+type roverRun struct {
+	walker     mazeWalker
+	heading    int
+	steps      int
+	budget     int
+	trajectory []Position
+	// failure describes why the run stopped before the end of the program
+	failure string
+	// arrived is set when the rover reaches the goal, which ends the run
+	arrived bool
+}
+
+// runRover executes a program from the start of a maze
+func runRover(grid *MazeGrid, spec RoverSpec, commands []roverCommand) *roverRun {
+	run := &roverRun{walker: newMazeWalker(grid), budget: spec.MaxSteps, trajectory: []Position{grid.Start}}
+	if run.budget == 0 {
+		run.budget = defaultRoverSteps
+	}
+	if spec.Heading != "" {
+		for i, direction := range grid.topology().directions() {
+			if direction == spec.Heading {
+				run.heading = i
+			}
+		}
+	}
+	run.arrived = grid.Start == grid.Goal
+	run.exec(commands)
+	return run
+}
+
+// stopped tells whether the run has ended
+func (r *roverRun) stopped() bool {
+	return r.arrived || r.failure != ""
+}
+
+// spend takes a step from the budget, failing the run once it is used up
+func (r *roverRun) spend() bool {
+	if r.steps == r.budget {
+		r.failure = fmt.Sprintf("Rover used up its budget of %d steps at %v", r.budget, r.walker.pos)
+		return false
+	}
+	r.steps++
+	return true
+}
+
+// ahead returns the cell in front of the rover
+func (r *roverRun) ahead() Position {
+	g := r.walker.grid
+	cell, _ := g.topology().step(r.walker.pos, g.topology().directions()[r.heading])
+	return cell
+}
+
+// wallAhead tells whether the edge of the maze, a blocked cell, a wall or a sealed corner is in front of the rover
+func (r *roverRun) wallAhead() bool {
+	g, next := r.walker.grid, r.ahead()
+	return !g.contains(next) || g.isBlocked(next) || g.hasWall(r.walker.pos, next) || g.cornerSealed(r.walker.pos, next)
+}
+
+// drive moves the rover to a cell, recording it, and fails the run if that breaks a rule of the maze
+func (r *roverRun) drive(next Position, line int) bool {
+	if err := r.walker.move(next); err != nil {
+		r.failure = fmt.Sprintf("Rover crashed at step %d (line %d): %v", r.steps, line, err)
+		return false
+	}
+	r.trajectory = append(r.trajectory, next)
+	r.arrived = next == r.walker.grid.Goal
+	return true
+}
+
+// exec runs commands until they end or the run stops
+func (r *roverRun) exec(commands []roverCommand) {
+	directions := len(r.walker.grid.topology().directions())
+	for _, command := range commands {
+		if r.stopped() {
+			return
+		}
+		switch command.Op {
+		case roverForward:
+			for i := 0; i < command.Count && !r.stopped(); i++ {
+				if !r.spend() || !r.drive(r.ahead(), command.Line) {
+					return
+				}
+				// Teleporters carry the rover on without using a step, but not past the goal
+				if r.walker.teleporting && !r.arrived {
+					teleporter, _ := r.walker.grid.teleporterAt(r.walker.pos)
+					if !r.drive(teleporter.To, command.Line) {
+						return
+					}
+				}
+			}
+		case roverTurn:
+			if !r.spend() {
+				return
+			}
+			if command.Right {
+				r.heading = (r.heading + 1) % directions
+			} else {
+				r.heading = (r.heading + directions - 1) % directions
+			}
+		case roverRepeat:
+			for i := 0; i < command.Count && !r.stopped(); i++ {
+				if !r.spend() {
+					return
+				}
+				r.exec(command.Body)
+			}
+		case roverIf:
+			if !r.spend() {
+				return
+			}
+			if r.wallAhead() != command.Negate {
+				r.exec(command.Body)
+			} else {
+				r.exec(command.Else)
+			}
+		}
+	}
+}
+
+// verifyRoverProgram runs a submitted program on the maze and checks that
+// the rover reaches the goal without crashing or running out of steps. The
+// rover stops as soon as it reaches the goal.
+func verifyRoverProgram(result PuzzleVerificationResult, grid MazeGrid, spec RoverSpec, program string) PuzzleVerificationResult {
+	commands, err := ParseRoverProgram(program)
+	if err != nil {
+		result.Message = fmt.Sprintf("Invalid program: %v", err)
+		return result
+	}
+
+	run := runRover(&grid, spec, commands)
+	result.Trajectory = run.trajectory
+	switch {
+	case run.failure != "":
+		result.Message = run.failure
+	case !run.arrived:
+		result.Message = fmt.Sprintf("Program ended with the rover at %v, not at the goal %v", run.walker.pos, grid.Goal)
+	default:
+		result.Valid = true
+		result.Message = fmt.Sprintf("Rover reached the goal in %d steps", run.steps)
+	}
+	return result
+}
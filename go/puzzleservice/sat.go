@@ -0,0 +1,241 @@
+package main
+
+import (
+	"fmt"
+)
+
+// Limits of the satisfiability checker
+const (
+	// maxSatVariables bounds the variables of a checked expression, so that counts fit an int64
+	maxSatVariables = 62
+	// maxListedSolutions bounds the number of satisfying assignments listed in a report
+	maxListedSolutions = 64
+	// maxSatBranches bounds the partial assignments the search may try, so
+	// that expressions that fold poorly fail instead of running for hours
+	maxSatBranches = 1 << 20
+)
+
+// SatReport describes the satisfying assignments of a logic expression
+type SatReport struct {
+	PuzzleID   string   `json:"puzzleId,omitempty"`
+	Expression string   `json:"expression"`
+	Variables  []string `json:"variables"`
+	// Count is the number of assignments of the variables that make the expression true
+	Count       int64 `json:"count"`
+	Satisfiable bool  `json:"satisfiable"`
+	Unique      bool  `json:"unique"`
+	// Solutions lists the satisfying assignments, at most maxListedSolutions of them
+	Solutions []map[string]bool `json:"solutions"`
+	// Truncated tells that more assignments satisfy the expression than are listed
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// constant returns a constant node with the given value
+func constant(value bool) *boolExpr {
+	text := "FALSE"
+	if value {
+		text = "TRUE"
+	}
+	return &boolExpr{Op: opConstant, Value: value, Text: text}
+}
+
+// isConstant tells whether the node is the given constant
+func (e *boolExpr) isConstant(value bool) bool {
+	return e.Op == opConstant && e.Value == value
+}
+
+// negate returns the negation of a node, folding constants and double negations
+func negate(e *boolExpr) *boolExpr {
+	switch e.Op {
+	case opConstant:
+		return constant(!e.Value)
+	case opNot:
+		return e.Operands[0]
+	}
+	return &boolExpr{Op: opNot, Operands: []*boolExpr{e}}
+}
+
+// assign substitutes a value for a variable and folds the constants that
+// result, leaving the rest of the expression as it was
+func (e *boolExpr) assign(name string, value bool) *boolExpr {
+	switch e.Op {
+	case opVariable:
+		if e.Name == name {
+			return constant(value)
+		}
+		return e
+	case opConstant:
+		return e
+	case opNot:
+		operand := e.Operands[0].assign(name, value)
+		if operand.Op == opConstant {
+			return constant(!operand.Value)
+		}
+		return &boolExpr{Op: opNot, Operands: []*boolExpr{operand}}
+	}
+
+	left, right := e.Operands[0].assign(name, value), e.Operands[1].assign(name, value)
+	if left.Op == opConstant && right.Op == opConstant {
+		node := &boolExpr{Op: e.Op, Operands: []*boolExpr{left, right}}
+		return constant(node.Eval(nil))
+	}
+
+	// One side is constant: the result is then a constant, the other side or its negation
+	other := left
+	if left.Op == opConstant {
+		other = right
+	}
+	constantSide := left.Op == opConstant || right.Op == opConstant
+	switch e.Op {
+	case opAnd:
+		if left.isConstant(false) || right.isConstant(false) {
+			return constant(false)
+		}
+		if left.isConstant(true) {
+			return right
+		}
+		if right.isConstant(true) {
+			return left
+		}
+	case opOr:
+		if left.isConstant(true) || right.isConstant(true) {
+			return constant(true)
+		}
+		if left.isConstant(false) {
+			return right
+		}
+		if right.isConstant(false) {
+			return left
+		}
+	case opImplies:
+		if left.isConstant(false) || right.isConstant(true) {
+			return constant(true)
+		}
+		if left.isConstant(true) {
+			return right
+		}
+		if right.isConstant(false) {
+			return negate(left)
+		}
+	case opNand:
+		if left.isConstant(false) || right.isConstant(false) {
+			return constant(true)
+		}
+		if constantSide {
+			return negate(other)
+		}
+	case opNor:
+		if left.isConstant(true) || right.isConstant(true) {
+			return constant(false)
+		}
+		if constantSide {
+			return negate(other)
+		}
+	case opXor:
+		if left.isConstant(false) || right.isConstant(false) {
+			return other
+		}
+		if constantSide {
+			return negate(other)
+		}
+	}
+	return &boolExpr{Op: e.Op, Operands: []*boolExpr{left, right}}
+}
+
+// CheckSatisfiability counts the assignments of the expression's variables
+// that make it true and lists the first of them. It branches on one
+// variable at a time, abandoning a branch as soon as the expression folds to
+// FALSE and counting every completion at once when it folds to TRUE. It
+// gives up with an error after maxSatBranches partial assignments.
+func CheckSatisfiability(expr *boolExpr) (SatReport, error) {
+	variables := expr.Variables()
+	if len(variables) > maxSatVariables {
+		return SatReport{}, fmt.Errorf("expression has %d variables, at most %d can be checked", len(variables), maxSatVariables)
+	}
+
+	report := SatReport{Expression: expr.Text, Variables: variables, Solutions: []map[string]bool{}}
+	values := make(map[string]bool, len(variables))
+
+	// list adds the completions of a satisfying partial assignment, up to the listing limit
+	var list func(depth int)
+	list = func(depth int) {
+		if len(report.Solutions) >= maxListedSolutions {
+			return
+		}
+		if depth == len(variables) {
+			solution := make(map[string]bool, len(values))
+			for name, value := range values {
+				solution[name] = value
+			}
+			report.Solutions = append(report.Solutions, solution)
+			return
+		}
+		for _, value := range []bool{false, true} {
+			values[variables[depth]] = value
+			list(depth + 1)
+		}
+		delete(values, variables[depth])
+	}
+
+	branches := 0
+	var search func(node *boolExpr, depth int)
+	search = func(node *boolExpr, depth int) {
+		if branches++; branches > maxSatBranches || node.isConstant(false) {
+			return
+		}
+		if node.isConstant(true) {
+			report.Count += int64(1) << uint(len(variables)-depth)
+			list(depth)
+			return
+		}
+		name := variables[depth]
+		for _, value := range []bool{false, true} {
+			values[name] = value
+			search(node.assign(name, value), depth+1)
+		}
+		delete(values, name)
+	}
+	search(expr, 0)
+	if branches > maxSatBranches {
+		return SatReport{}, fmt.Errorf("expression is too complex to check: gave up after %d partial assignments", maxSatBranches)
+	}
+
+	report.Satisfiable = report.Count > 0
+	report.Unique = report.Count == 1
+	report.Truncated = report.Count > int64(len(report.Solutions))
+	return report, nil
+}
+
+// describeSolutionCount phrases the number of satisfying assignments for messages
+func describeSolutionCount(count int64) string {
+	switch count {
+	case 0:
+		return "no satisfying assignment"
+	case 1:
+		return "1 satisfying assignment"
+	}
+	return fmt.Sprintf("%d satisfying assignments", count)
+}
+
+// validateUniqueSolution checks that a puzzle marked as having a unique
+// answer has an expression with exactly one satisfying assignment
+func validateUniqueSolution(puzzle Puzzle) error {
+	if !puzzle.UniqueSolution {
+		return nil
+	}
+	if puzzle.Expression == "" {
+		return fmt.Errorf("a unique solution needs an expression to check")
+	}
+	expr, err := ParseBoolExpr(puzzle.Expression)
+	if err != nil {
+		return err
+	}
+	report, err := CheckSatisfiability(expr)
+	if err != nil {
+		return err
+	}
+	if !report.Unique {
+		return fmt.Errorf("expression should have a unique solution but has %s", describeSolutionCount(report.Count))
+	}
+	return nil
+}
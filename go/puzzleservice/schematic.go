@@ -0,0 +1,445 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Layout of a rendered schematic. Components sit in a grid of cells, with
+// wires routed through the channels along the bottom and left of each cell.
+const (
+	schematicMargin     = 20.0
+	schematicCellWidth  = 160.0
+	schematicCellHeight = 120.0
+	schematicLegend     = 70.0
+	// schematicLegendEntry is the width of one entry of the wire legend
+	schematicLegendEntry = 150.0
+)
+
+// Colors used to draw wires and symbols
+const (
+	schematicInk     = "#222222"
+	schematicExtra   = "#d62728"
+	schematicMissing = "#ff7f0e"
+)
+
+// wireStatus tells how a wire compares with the stored circuit
+type wireStatus int
+
+const (
+	wireMatches wireStatus = iota
+	wireExtra
+	wireMissing
+)
+
+// schematicWire is a wire between two pin references
+type schematicWire struct {
+	From, To string
+	Status   wireStatus
+}
+
+// schematicPoint is a position on the drawing
+type schematicPoint struct {
+	X, Y float64
+}
+
+// RenderCircuitSVG draws the stored solution of a circuit puzzle as an SVG
+// schematic. Given a submitted solution, it draws the submission instead and
+// colors the wires that differ from the stored solution.
+func RenderCircuitSVG(puzzle Puzzle, solution json.RawMessage) (string, error) {
+	if puzzle.Type != TypeCircuit {
+		return "", fmt.Errorf("puzzle '%s' is not a circuit puzzle", puzzle.ID)
+	}
+
+	var correctSolution CircuitSolution
+	if err := json.Unmarshal(puzzle.Solution, &correctSolution); err != nil {
+		return "", fmt.Errorf("failed to parse stored solution: %v", err)
+	}
+	parts := circuitParts(puzzle.Components)
+	reference, err := buildNetlist(correctSolution.Connections, parts)
+	if err != nil {
+		return "", err
+	}
+
+	if solution == nil {
+		var wires []schematicWire
+		for _, wire := range reference.Wires {
+			wires = append(wires, schematicWire{From: wire.From, To: wire.To})
+		}
+		return renderSchematic(puzzle.Name, schematicComponents(puzzle.Components, reference), wires, false), nil
+	}
+
+	var submittedSolution CircuitSolution
+	if err := json.Unmarshal(solution, &submittedSolution); err != nil {
+		return "", fmt.Errorf("invalid circuit solution format: %v", err)
+	}
+	submitted, err := buildNetlist(submittedSolution.Connections, parts)
+	if err != nil {
+		return "", err
+	}
+
+	// Compare wires by the nodes they join, as the verifier's diagnostics do
+	var wires []schematicWire
+	referenceNodes := reference.pinNodes()
+	for _, wire := range submitted.Wires {
+		status := wireMatches
+		if !joins(referenceNodes, wire) {
+			status = wireExtra
+		}
+		wires = append(wires, schematicWire{From: wire.From, To: wire.To, Status: status})
+	}
+	submittedNodes := submitted.pinNodes()
+	for _, wire := range reference.Wires {
+		if !joins(submittedNodes, wire) {
+			wires = append(wires, schematicWire{From: wire.From, To: wire.To, Status: wireMissing})
+		}
+	}
+
+	return renderSchematic(puzzle.Name, schematicComponents(puzzle.Components, submitted, reference), wires, true), nil
+}
+
+// schematicComponents lists the components to draw: the parts bin followed
+// by any other component of the given netlists
+func schematicComponents(bin []Component, netlists ...circuitNetlist) []Component {
+	var components []Component
+	seen := make(map[string]bool)
+	for _, c := range bin {
+		seen[c.ID] = true
+		components = append(components, c.withDefaults())
+	}
+	for _, netlist := range netlists {
+		for _, c := range netlist.Components {
+			if !seen[c.ID] {
+				seen[c.ID] = true
+				components = append(components, c.Component)
+			}
+		}
+	}
+	return components
+}
+
+// placeComponents orders components so that wired neighbours sit next to
+// each other, starting from the batteries, and assigns each a grid cell
+func placeComponents(components []Component, wires []schematicWire) (map[string][2]int, int, int) {
+	neighbours := make(map[string][]string)
+	for _, wire := range wires {
+		from, _ := splitPinRef(wire.From)
+		to, _ := splitPinRef(wire.To)
+		neighbours[from] = append(neighbours[from], to)
+		neighbours[to] = append(neighbours[to], from)
+	}
+
+	starts := make([]Component, len(components))
+	copy(starts, components)
+	sort.SliceStable(starts, func(i, j int) bool {
+		return starts[i].Kind == KindBattery && starts[j].Kind != KindBattery
+	})
+
+	var order []string
+	visited := make(map[string]bool)
+	for _, start := range starts {
+		if visited[start.ID] {
+			continue
+		}
+		visited[start.ID] = true
+		queue := []string{start.ID}
+		for len(queue) > 0 {
+			id := queue[0]
+			queue = queue[1:]
+			order = append(order, id)
+			for _, next := range neighbours[id] {
+				if !visited[next] {
+					visited[next] = true
+					queue = append(queue, next)
+				}
+			}
+		}
+	}
+
+	columns := int(math.Ceil(math.Sqrt(float64(len(order)))))
+	if columns == 0 {
+		columns = 1
+	}
+	cells := make(map[string][2]int)
+	for i, id := range order {
+		cells[id] = [2]int{i % columns, i / columns}
+	}
+	rows := (len(order) + columns - 1) / columns
+	return cells, columns, rows
+}
+
+// cellOrigin returns the top-left corner of a grid cell
+func cellOrigin(cell [2]int) schematicPoint {
+	return schematicPoint{
+		X: schematicMargin + float64(cell[0])*schematicCellWidth,
+		Y: schematicMargin + float64(cell[1])*schematicCellHeight,
+	}
+}
+
+// pinPosition returns where a pin of a component placed in a cell is drawn.
+// Two-pin components run left to right; a transistor has its base on the
+// left and its collector and emitter on the right.
+func pinPosition(c Component, pin int, cell [2]int) schematicPoint {
+	o := cellOrigin(cell)
+	switch {
+	case c.Kind == KindJunction:
+		return schematicPoint{o.X + 80, o.Y + 60}
+	case c.Kind == KindTransistor && pin == 1:
+		return schematicPoint{o.X + 140, o.Y + 30}
+	case c.Kind == KindTransistor && pin == 2:
+		return schematicPoint{o.X + 120, o.Y + 90}
+	case pin == 0:
+		return schematicPoint{o.X + 30, o.Y + 60}
+	}
+	return schematicPoint{o.X + 130, o.Y + 60}
+}
+
+// renderSchematic draws the components and wires as an SVG document
+func renderSchematic(title string, components []Component, wires []schematicWire, legend bool) string {
+	cells, columns, rows := placeComponents(components, wires)
+	byID := make(map[string]Component)
+	for _, c := range components {
+		byID[c.ID] = c
+	}
+
+	width := 2*schematicMargin + float64(columns)*schematicCellWidth
+	height := 2*schematicMargin + float64(rows)*schematicCellHeight
+	if legend {
+		height += schematicLegend
+		width = math.Max(width, 2*schematicMargin+3*schematicLegendEntry)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%g" height="%g" viewBox="0 0 %g %g" font-family="sans-serif" font-size="11">`+"\n", width, height, width, height)
+	fmt.Fprintf(&b, "<title>%s</title>\n", escapeXML(title))
+	fmt.Fprintf(&b, `<rect width="100%%" height="100%%" fill="white"/>`+"\n")
+
+	// Wires go underneath the symbols
+	for i, wire := range wires {
+		from, ok := wireEnd(byID, cells, wire.From)
+		if !ok {
+			continue
+		}
+		to, ok := wireEnd(byID, cells, wire.To)
+		if !ok {
+			continue
+		}
+		drawWire(&b, from, to, i, wire.Status)
+	}
+
+	ids := make([]string, 0, len(cells))
+	for id := range cells {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		drawSymbol(&b, byID[id], cells[id])
+	}
+
+	if legend {
+		y := height - schematicLegend + 20
+		entries := []struct {
+			label  string
+			status wireStatus
+		}{
+			{"matches the puzzle", wireMatches},
+			{"extra wire", wireExtra},
+			{"missing wire", wireMissing},
+		}
+		for i, entry := range entries {
+			x := schematicMargin + float64(i)*schematicLegendEntry
+			color, dash := wireStyle(entry.status)
+			fmt.Fprintf(&b, `<line x1="%g" y1="%g" x2="%g" y2="%g" stroke="%s" stroke-width="2"%s/>`+"\n", x, y, x+30, y, color, dash)
+			fmt.Fprintf(&b, `<text x="%g" y="%g">%s</text>`+"\n", x+36, y+4, entry.label)
+		}
+	}
+
+	b.WriteString("</svg>\n")
+	return b.String()
+}
+
+// wireEnd finds the drawing position of a pin reference
+func wireEnd(byID map[string]Component, cells map[string][2]int, ref string) (schematicPoint, bool) {
+	id, pin := splitPinRef(ref)
+	c, ok := byID[id]
+	if !ok {
+		return schematicPoint{}, false
+	}
+	index, ok := c.pinIndex(pin)
+	if !ok {
+		return schematicPoint{}, false
+	}
+	return pinPosition(c, index, cells[id]), true
+}
+
+// wireStyle returns the stroke color and dash attribute for a wire status
+func wireStyle(status wireStatus) (string, string) {
+	switch status {
+	case wireExtra:
+		return schematicExtra, ""
+	case wireMissing:
+		return schematicMissing, ` stroke-dasharray="6 4"`
+	}
+	return schematicInk, ""
+}
+
+// drawWire routes a wire from one pin to another through the channels
+// below the rows and left of the columns. Each wire gets its own offset
+// within the channels so parallel runs stay apart.
+func drawWire(b *strings.Builder, from, to schematicPoint, index int, status wireStatus) {
+	offset := float64(index%4) * 3
+	fromChannel := channelBelow(from.Y) + offset
+	toChannel := channelBelow(to.Y) + offset
+
+	points := []schematicPoint{from, {from.X, fromChannel}}
+	if fromChannel != toChannel {
+		column := math.Floor((to.X - schematicMargin) / schematicCellWidth)
+		x := schematicMargin + column*schematicCellWidth + 6 + offset
+		points = append(points, schematicPoint{x, fromChannel}, schematicPoint{x, toChannel})
+	}
+	points = append(points, schematicPoint{to.X, toChannel}, to)
+
+	coords := make([]string, len(points))
+	for i, p := range points {
+		coords[i] = fmt.Sprintf("%g,%g", p.X, p.Y)
+	}
+	color, dash := wireStyle(status)
+	fmt.Fprintf(b, `<polyline points="%s" fill="none" stroke="%s" stroke-width="1.5"%s/>`+"\n", strings.Join(coords, " "), color, dash)
+	for _, p := range []schematicPoint{from, to} {
+		fmt.Fprintf(b, `<circle cx="%g" cy="%g" r="2.5" fill="%s"/>`+"\n", p.X, p.Y, color)
+	}
+}
+
+// channelBelow returns the y position of the wiring channel below the row containing y
+func channelBelow(y float64) float64 {
+	row := math.Floor((y - schematicMargin) / schematicCellHeight)
+	return schematicMargin + (row+1)*schematicCellHeight - 14
+}
+
+// drawSymbol draws the standard symbol of a component with its ID and value
+func drawSymbol(b *strings.Builder, c Component, cell [2]int) {
+	o := cellOrigin(cell)
+	cx, cy := o.X+80, o.Y+60
+	line := func(x1, y1, x2, y2 float64) {
+		fmt.Fprintf(b, `<line x1="%g" y1="%g" x2="%g" y2="%g" stroke="%s" stroke-width="1.5"/>`+"\n", x1, y1, x2, y2, schematicInk)
+	}
+	// leads draws the wires from both pins of a two-pin component to its body
+	leads := func(halfWidth float64) {
+		line(o.X+30, cy, cx-halfWidth, cy)
+		line(cx+halfWidth, cy, o.X+130, cy)
+	}
+
+	fmt.Fprintf(b, `<g id="%s">`+"\n", escapeXML(c.ID))
+	switch c.Kind {
+	case KindBattery:
+		// Short plate for the negative terminal, long plate for the positive one
+		leads(6)
+		line(cx-6, cy-7, cx-6, cy+7)
+		line(cx+6, cy-16, cx+6, cy+16)
+		fmt.Fprintf(b, `<text x="%g" y="%g">+</text>`+"\n", cx+10, cy-10)
+	case KindResistor:
+		leads(24)
+		fmt.Fprintf(b, `<polyline points="%g,%g %g,%g %g,%g %g,%g %g,%g %g,%g %g,%g" fill="none" stroke="%s" stroke-width="1.5"/>`+"\n",
+			cx-24, cy, cx-18, cy-8, cx-10, cy+8, cx-2, cy-8, cx+6, cy+8, cx+14, cy-8, cx+24, cy, schematicInk)
+	case KindLED:
+		leads(12)
+		fmt.Fprintf(b, `<polygon points="%g,%g %g,%g %g,%g" fill="none" stroke="%s" stroke-width="1.5"/>`+"\n",
+			cx-12, cy-12, cx-12, cy+12, cx+12, cy, schematicInk)
+		line(cx+12, cy-12, cx+12, cy+12)
+		// Arrows for the emitted light
+		line(cx+2, cy-14, cx+10, cy-22)
+		line(cx+8, cy-10, cx+16, cy-18)
+	case KindSwitch:
+		leads(20)
+		fmt.Fprintf(b, `<circle cx="%g" cy="%g" r="2.5" fill="none" stroke="%s"/>`+"\n", cx-20, cy, schematicInk)
+		fmt.Fprintf(b, `<circle cx="%g" cy="%g" r="2.5" fill="none" stroke="%s"/>`+"\n", cx+20, cy, schematicInk)
+		if c.Closed != nil && !*c.Closed {
+			line(cx-18, cy-1, cx+16, cy-16)
+		} else {
+			line(cx-18, cy-1, cx+18, cy-1)
+		}
+	case KindJunction:
+		fmt.Fprintf(b, `<circle cx="%g" cy="%g" r="4" fill="%s"/>`+"\n", cx, cy, schematicInk)
+	case KindBuzzer, KindMotor:
+		leads(16)
+		fmt.Fprintf(b, `<circle cx="%g" cy="%g" r="16" fill="none" stroke="%s" stroke-width="1.5"/>`+"\n", cx, cy, schematicInk)
+		label := "M"
+		if c.Kind == KindBuzzer {
+			label = "BZ"
+		}
+		fmt.Fprintf(b, `<text x="%g" y="%g" text-anchor="middle">%s</text>`+"\n", cx, cy+4, label)
+	case KindTransistor:
+		fmt.Fprintf(b, `<circle cx="%g" cy="%g" r="22" fill="none" stroke="%s" stroke-width="1.5"/>`+"\n", cx, cy, schematicInk)
+		line(o.X+30, cy, cx-10, cy)
+		line(cx-10, cy-14, cx-10, cy+14)
+		// Collector up to its pin, emitter with its arrow down to its pin
+		line(cx-10, cy-6, cx+12, cy-20)
+		line(cx+12, cy-20, cx+12, cy-30)
+		line(cx+12, cy-30, o.X+140, cy-30)
+		line(cx-10, cy+6, cx+12, cy+20)
+		fmt.Fprintf(b, `<polygon points="%g,%g %g,%g %g,%g" fill="%s"/>`+"\n", cx+12, cy+20, cx+3, cy+18, cx+8, cy+12, schematicInk)
+		line(cx+12, cy+20, cx+12, cy+30)
+		line(cx+12, cy+30, o.X+120, cy+30)
+	case KindCapacitor:
+		leads(4)
+		line(cx-4, cy-14, cx-4, cy+14)
+		line(cx+4, cy-14, cx+4, cy+14)
+	case KindInductor:
+		leads(24)
+		fmt.Fprintf(b, `<path d="M%g,%g a6,6 0 0 1 12,0 a6,6 0 0 1 12,0 a6,6 0 0 1 12,0 a6,6 0 0 1 12,0" fill="none" stroke="%s" stroke-width="1.5"/>`+"\n",
+			cx-24, cy, schematicInk)
+	}
+
+	fmt.Fprintf(b, `<text x="%g" y="%g" text-anchor="middle">%s</text>`+"\n", cx, o.Y+100, escapeXML(c.ID))
+	if value := componentValue(c); value != "" {
+		fmt.Fprintf(b, `<text x="%g" y="%g" text-anchor="middle" fill="#555555">%s</text>`+"\n", cx, o.Y+24, value)
+	}
+	b.WriteString("</g>\n")
+}
+
+// componentValue describes the main parameter of a component, e.g. "470 Ω"
+func componentValue(c Component) string {
+	switch c.Kind {
+	case KindBattery:
+		return formatUnit(c.Voltage, "V")
+	case KindResistor, KindBuzzer, KindMotor:
+		return formatUnit(c.Resistance, "Ω")
+	case KindLED:
+		return formatUnit(c.ForwardVoltage, "V")
+	case KindCapacitor:
+		return formatUnit(c.Capacitance, "F")
+	case KindInductor:
+		return formatUnit(c.Inductance, "H")
+	case KindTransistor:
+		return fmt.Sprintf("β=%g", c.Gain)
+	}
+	return ""
+}
+
+// formatUnit formats a value with a metric prefix, e.g. 0.00022 F as "220 µF"
+func formatUnit(v float64, unit string) string {
+	prefixes := []struct {
+		exponent int
+		prefix   string
+	}{
+		{6, "M"}, {3, "k"}, {0, ""}, {-3, "m"}, {-6, "µ"}, {-9, "n"}, {-12, "p"},
+	}
+	for _, p := range prefixes {
+		if math.Abs(v) >= math.Pow10(p.exponent) {
+			scaled := v / math.Pow10(p.exponent)
+			if p.exponent < 0 {
+				scaled = v * math.Pow10(-p.exponent)
+			}
+			return fmt.Sprintf("%s %s%s", strings.TrimSuffix(fmt.Sprintf("%.3g", scaled), ".0"), p.prefix, unit)
+		}
+	}
+	return fmt.Sprintf("%g %s", v, unit)
+}
+
+// escapeXML escapes text for use in SVG markup
+func escapeXML(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;").Replace(s)
+}
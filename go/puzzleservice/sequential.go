@@ -0,0 +1,268 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Latch and flip-flop gate types. Flip-flops change on the clock edge at
+// the end of each cycle; latches are level-sensitive and follow their
+// inputs within a cycle.
+const (
+	gateDFlipFlop  = "DFF"
+	gateTFlipFlop  = "TFF"
+	gateJKFlipFlop = "JKFF"
+	gateSRLatch    = "SR"
+	gateDLatch     = "DLATCH"
+)
+
+// maxLatchIterations bounds the passes spent waiting for latches to settle within a cycle
+const maxLatchIterations = 32
+
+// SequentialSpec declares a clocked logic puzzle: the input values applied
+// in each clock cycle and the outputs expected after each clock edge
+type SequentialSpec struct {
+	Inputs  []string `json:"inputs"`
+	Outputs []string `json:"outputs"`
+	// Stimulus lists the inputs of each cycle; inputs left out keep their
+	// previous value and start low
+	Stimulus []map[string]bool `json:"stimulus"`
+	// Expected lists the outputs after each cycle; outputs left out are not checked
+	Expected     []map[string]bool `json:"expected"`
+	AllowedGates []string          `json:"allowedGates,omitempty"`
+}
+
+// CycleTrace records the inputs and outputs of one clock cycle
+type CycleTrace struct {
+	Cycle    int             `json:"cycle"`
+	Inputs   map[string]bool `json:"inputs"`
+	Expected map[string]bool `json:"expected,omitempty"`
+	Outputs  map[string]bool `json:"outputs"`
+}
+
+// isSequential tells whether a gate type stores state
+func isSequential(gateType string) bool {
+	switch gateType {
+	case gateDFlipFlop, gateTFlipFlop, gateJKFlipFlop, gateSRLatch, gateDLatch:
+		return true
+	}
+	return false
+}
+
+// isLatch tells whether a gate type is a level-sensitive latch
+func isLatch(gateType string) bool {
+	return gateType == gateSRLatch || gateType == gateDLatch
+}
+
+// validateSequential checks that a sequential puzzle is well formed
+func validateSequential(spec *SequentialSpec) error {
+	if spec == nil {
+		return nil
+	}
+	if len(spec.Outputs) == 0 {
+		return fmt.Errorf("sequential puzzle declares no outputs")
+	}
+	if len(spec.Expected) != len(spec.Stimulus) {
+		return fmt.Errorf("sequential puzzle has %d stimulus cycles but %d expected cycles", len(spec.Stimulus), len(spec.Expected))
+	}
+	for i, cycle := range spec.Stimulus {
+		for name := range cycle {
+			if !containsString(spec.Inputs, name) {
+				return fmt.Errorf("cycle %d drives '%s', which is not an input", i+1, name)
+			}
+		}
+	}
+	for i, cycle := range spec.Expected {
+		for name := range cycle {
+			if !containsString(spec.Outputs, name) {
+				return fmt.Errorf("cycle %d expects '%s', which is not an output", i+1, name)
+			}
+		}
+	}
+	return nil
+}
+
+// sequentialIDs returns the IDs of the latches or flip-flops of the network, sorted
+func (n *gateNetwork) sequentialIDs(latches bool) []string {
+	var ids []string
+	for id, gate := range n.gates {
+		if isSequential(gate.Type) && isLatch(gate.Type) == latches {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// settle evaluates the network for the given inputs, letting transparent
+// latches follow their inputs until nothing changes. It returns the values
+// of every signal that was evaluated.
+func (n *gateNetwork) settle(inputs map[string]bool) (map[string]bool, error) {
+	latches := n.sequentialIDs(true)
+	for iteration := 0; iteration < maxLatchIterations; iteration++ {
+		values := make(map[string]bool, len(inputs))
+		for name, value := range inputs {
+			values[name] = value
+		}
+
+		changed := false
+		for _, id := range latches {
+			gate := n.gates[id]
+			a, b := n.signal(gate.Inputs[0], values), n.signal(gate.Inputs[1], values)
+			next := n.state[id]
+			switch gate.Type {
+			case gateSRLatch:
+				// Set wins over hold, reset over hold; both high holds the value
+				if a && !b {
+					next = true
+				} else if b && !a {
+					next = false
+				}
+			case gateDLatch:
+				if b {
+					next = a
+				}
+			}
+			if next != n.state[id] {
+				n.state[id] = next
+				changed = true
+			}
+		}
+		if !changed {
+			return values, nil
+		}
+	}
+	return nil, fmt.Errorf("latches do not settle")
+}
+
+// clock applies a clock edge: every flip-flop takes its next value at once
+func (n *gateNetwork) clock(values map[string]bool) {
+	next := make(map[string]bool)
+	for _, id := range n.sequentialIDs(false) {
+		gate := n.gates[id]
+		q := n.state[id]
+		in := n.signal(gate.Inputs[0], values)
+		switch gate.Type {
+		case gateDFlipFlop:
+			next[id] = in
+		case gateTFlipFlop:
+			next[id] = q != in
+		case gateJKFlipFlop:
+			k := n.signal(gate.Inputs[1], values)
+			switch {
+			case in && k:
+				next[id] = !q
+			case in:
+				next[id] = true
+			case k:
+				next[id] = false
+			default:
+				next[id] = q
+			}
+		}
+	}
+	for id, value := range next {
+		n.state[id] = value
+	}
+}
+
+// formatSignals formats signal values in name order, e.g. "Q0=1, Q1=0"
+func formatSignals(values map[string]bool) string {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parts := make([]string, len(names))
+	for i, name := range names {
+		bit := 0
+		if values[name] {
+			bit = 1
+		}
+		parts[i] = fmt.Sprintf("%s=%d", name, bit)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// verifySequentialCircuit simulates a submitted gate and flip-flop network
+// cycle by cycle and compares its outputs with the expected trace
+func verifySequentialCircuit(result PuzzleVerificationResult, spec SequentialSpec, submitted LogicSolution) PuzzleVerificationResult {
+	if len(submitted.Gates) == 0 {
+		result.Message = "Logic circuit has no gates"
+		return result
+	}
+
+	network, err := newGateNetwork(submitted.Gates, spec.Inputs)
+	if err != nil {
+		result.Message = fmt.Sprintf("Invalid logic circuit: %v", err)
+		return result
+	}
+
+	for _, gate := range submitted.Gates {
+		allowed := len(spec.AllowedGates) == 0
+		for _, gateType := range spec.AllowedGates {
+			allowed = allowed || strings.EqualFold(gateType, gate.Type)
+		}
+		if !allowed {
+			result.Message = fmt.Sprintf("Gate '%s' is of type %s, but only %s gates may be used", gate.ID, strings.ToUpper(gate.Type), strings.Join(spec.AllowedGates, ", "))
+			return result
+		}
+	}
+
+	for _, name := range spec.Outputs {
+		source, ok := submitted.Outputs[name]
+		if !ok {
+			result.Message = fmt.Sprintf("Output '%s' is not connected", name)
+			return result
+		}
+		if _, ok := network.gates[source]; !ok && !containsString(spec.Inputs, source) {
+			result.Message = fmt.Sprintf("Output '%s' reads '%s', which is neither an input nor a gate", name, source)
+			return result
+		}
+	}
+
+	inputs := make(map[string]bool)
+	for _, name := range spec.Inputs {
+		inputs[name] = false
+	}
+
+	for i, stimulus := range spec.Stimulus {
+		cycle := CycleTrace{Cycle: i + 1, Inputs: make(map[string]bool), Expected: spec.Expected[i], Outputs: make(map[string]bool)}
+		for name, value := range stimulus {
+			inputs[name] = value
+		}
+		for name, value := range inputs {
+			cycle.Inputs[name] = value
+		}
+
+		// Settle the latches, clock the flip-flops, then settle again and sample
+		values, err := network.settle(inputs)
+		if err == nil {
+			network.clock(values)
+			values, err = network.settle(inputs)
+		}
+		if err != nil {
+			result.Message = fmt.Sprintf("Logic circuit fails in cycle %d: %v", cycle.Cycle, err)
+			return result
+		}
+		for _, name := range spec.Outputs {
+			cycle.Outputs[name] = network.signal(submitted.Outputs[name], values)
+		}
+		result.Trace = append(result.Trace, cycle)
+
+		for name, want := range cycle.Expected {
+			if cycle.Outputs[name] != want {
+				result.FirstDivergentCycle = cycle.Cycle
+				result.Message = fmt.Sprintf("Outputs diverge at cycle %d: expected %s, got %s",
+					cycle.Cycle, formatSignals(cycle.Expected), formatSignals(cycle.Outputs))
+				return result
+			}
+		}
+	}
+
+	result.Valid = true
+	result.Message = "Sequential circuit matches the expected trace"
+	return result
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// linearSystem is a dense system of linear equations A*x = b
+type linearSystem struct {
+	A [][]float64
+	B []float64
+}
+
+// newLinearSystem creates an empty system with n unknowns
+func newLinearSystem(n int) *linearSystem {
+	a := make([][]float64, n)
+	for i := range a {
+		a[i] = make([]float64, n)
+	}
+	return &linearSystem{
+		A: a,
+		B: make([]float64, n),
+	}
+}
+
+// addConductance stamps a conductance between nodes a and b (-1 is ground)
+func (s *linearSystem) addConductance(a, b int, g float64) {
+	if a >= 0 {
+		s.A[a][a] += g
+	}
+	if b >= 0 {
+		s.A[b][b] += g
+	}
+	if a >= 0 && b >= 0 {
+		s.A[a][b] -= g
+		s.A[b][a] -= g
+	}
+}
+
+// addCurrent stamps a current source pushing current from node a into node b
+func (s *linearSystem) addCurrent(a, b int, i float64) {
+	if a >= 0 {
+		s.B[a] -= i
+	}
+	if b >= 0 {
+		s.B[b] += i
+	}
+}
+
+// solve solves the system using Gaussian elimination with partial pivoting
+func (s *linearSystem) solve() ([]float64, error) {
+	n := len(s.B)
+	a := make([][]float64, n)
+	for i := range s.A {
+		a[i] = append([]float64(nil), s.A[i]...)
+	}
+	b := append([]float64(nil), s.B...)
+
+	for col := 0; col < n; col++ {
+		// Find the row with the largest pivot
+		pivot := col
+		for row := col + 1; row < n; row++ {
+			if math.Abs(a[row][col]) > math.Abs(a[pivot][col]) {
+				pivot = row
+			}
+		}
+		if math.Abs(a[pivot][col]) < 1e-15 {
+			return nil, fmt.Errorf("singular circuit equations")
+		}
+		a[col], a[pivot] = a[pivot], a[col]
+		b[col], b[pivot] = b[pivot], b[col]
+
+		// Eliminate the column below the pivot
+		for row := col + 1; row < n; row++ {
+			factor := a[row][col] / a[col][col]
+			if factor == 0 {
+				continue
+			}
+			for k := col; k < n; k++ {
+				a[row][k] -= factor * a[col][k]
+			}
+			b[row] -= factor * b[col]
+		}
+	}
+
+	// Back substitution
+	x := make([]float64, n)
+	for row := n - 1; row >= 0; row-- {
+		sum := b[row]
+		for k := row + 1; k < n; k++ {
+			sum -= a[row][k] * x[k]
+		}
+		x[row] = sum / a[row][row]
+	}
+
+	return x, nil
+}
@@ -0,0 +1,477 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Constants used to translate between the circuit model and SPICE
+const (
+	// spiceThermalVoltage is the diode thermal voltage at room temperature
+	spiceThermalVoltage = 0.02585
+	// spiceLEDEmission is the emission coefficient used for LED models
+	spiceLEDEmission = 2.0
+	// spiceLEDCurrent is the current at which an LED model drops its forward voltage
+	spiceLEDCurrent = 0.01
+	// spiceOpenResistance is the resistance standing in for an open switch
+	spiceOpenResistance = 1e9
+	// spiceInternalSuffix marks the resistor holding a battery's internal resistance
+	spiceInternalSuffix = "_int"
+	// spiceResistorMarker is the comment naming a part written as a resistor, e.g. "* switch sw1 modelled as a resistor"
+	spiceResistorMarker = "modelled as a resistor"
+)
+
+// spiceNodeNames names the nodes of a netlist, using "0" for the negative
+// terminal of the first battery so reference simulators have a ground
+func spiceNodeNames(netlist circuitNetlist) []string {
+	ground := 0
+	for _, c := range netlist.Components {
+		if c.Kind == KindBattery {
+			ground = c.Nodes[0]
+			break
+		}
+	}
+
+	names := make([]string, netlist.NodeCount)
+	next := 1
+	for node := range names {
+		if node == ground {
+			names[node] = "0"
+			continue
+		}
+		names[node] = fmt.Sprintf("n%d", next)
+		next++
+	}
+	return names
+}
+
+// formatSpiceValue formats a value using SPICE engineering suffixes
+func formatSpiceValue(v float64) string {
+	suffixes := []struct {
+		scale  float64
+		suffix string
+	}{
+		{1e9, "g"}, {1e6, "meg"}, {1e3, "k"}, {1, ""}, {1e-3, "m"}, {1e-6, "u"}, {1e-9, "n"}, {1e-12, "p"},
+	}
+	for _, s := range suffixes {
+		if math.Abs(v) >= s.scale {
+			return strconv.FormatFloat(v/s.scale, 'g', 6, 64) + s.suffix
+		}
+	}
+	return strconv.FormatFloat(v, 'g', 6, 64)
+}
+
+// circuitToSpice writes a netlist as a plain SPICE deck with an operating point analysis
+func circuitToSpice(title string, netlist circuitNetlist) string {
+	names := spiceNodeNames(netlist)
+	var lines, models []string
+	lines = append(lines, "* "+title)
+
+	for _, c := range netlist.Components {
+		nodes := make([]string, len(c.Nodes))
+		for i, node := range c.Nodes {
+			nodes[i] = names[node]
+		}
+
+		switch c.Kind {
+		case KindBattery:
+			// The internal resistance sits between the source and the positive terminal
+			internal := c.ID + spiceInternalSuffix
+			lines = append(lines,
+				fmt.Sprintf("V%s %s %s DC %s", c.ID, internal, nodes[0], formatSpiceValue(c.Voltage)),
+				fmt.Sprintf("R%s %s %s %s", internal, internal, nodes[1], formatSpiceValue(c.InternalResistance)))
+		case KindResistor:
+			lines = append(lines, fmt.Sprintf("R%s %s %s %s", c.ID, nodes[0], nodes[1], formatSpiceValue(c.Resistance)))
+		case KindBuzzer, KindMotor:
+			lines = append(lines,
+				fmt.Sprintf("* %s %s %s", c.Kind, c.ID, spiceResistorMarker),
+				fmt.Sprintf("R%s %s %s %s", c.ID, nodes[0], nodes[1], formatSpiceValue(c.Resistance)))
+		case KindSwitch:
+			resistance := switchClosedResistance
+			if !*c.Closed {
+				resistance = spiceOpenResistance
+			}
+			lines = append(lines,
+				fmt.Sprintf("* %s %s %s", c.Kind, c.ID, spiceResistorMarker),
+				fmt.Sprintf("R%s %s %s %s", c.ID, nodes[0], nodes[1], formatSpiceValue(resistance)))
+		case KindLED:
+			// Pick the saturation current so the diode drops its forward voltage at 10 mA
+			saturation := spiceLEDCurrent / math.Exp(c.ForwardVoltage/(spiceLEDEmission*spiceThermalVoltage))
+			lines = append(lines, fmt.Sprintf("D%s %s %s LED_%s", c.ID, nodes[0], nodes[1], c.ID))
+			models = append(models, fmt.Sprintf(".model LED_%s D(IS=%s N=%g RS=%g BV=%g)",
+				c.ID, formatSpiceValue(saturation), spiceLEDEmission, ledOnResistance, c.MaxReverseVoltage))
+		case KindCapacitor:
+			lines = append(lines, fmt.Sprintf("C%s %s %s %s", c.ID, nodes[0], nodes[1], formatSpiceValue(c.Capacitance)))
+		case KindInductor:
+			// The winding resistance sits in series with the ideal inductor
+			internal := c.ID + spiceInternalSuffix
+			lines = append(lines,
+				fmt.Sprintf("L%s %s %s %s", c.ID, nodes[0], internal, formatSpiceValue(c.Inductance)),
+				fmt.Sprintf("R%s %s %s %s", internal, internal, nodes[1], formatSpiceValue(c.Resistance)))
+		case KindTransistor:
+			// SPICE orders transistor nodes collector, base, emitter
+			lines = append(lines, fmt.Sprintf("Q%s %s %s %s NPN_%s", c.ID, nodes[1], nodes[0], nodes[2], c.ID))
+			models = append(models, fmt.Sprintf(".model NPN_%s NPN(BF=%g)", c.ID, c.Gain))
+		}
+	}
+
+	lines = append(lines, models...)
+	lines = append(lines, ".op", ".end")
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// PuzzleToSpice converts the stored solution of a circuit puzzle, or a
+// submitted circuit solution for it, to a SPICE netlist
+func PuzzleToSpice(puzzle Puzzle, solution json.RawMessage) (string, error) {
+	if puzzle.Type != TypeCircuit {
+		return "", fmt.Errorf("puzzle '%s' is not a circuit puzzle", puzzle.ID)
+	}
+	if solution == nil {
+		solution = puzzle.Solution
+	}
+
+	var circuit CircuitSolution
+	if err := json.Unmarshal(solution, &circuit); err != nil {
+		return "", fmt.Errorf("invalid circuit solution format: %v", err)
+	}
+
+	netlist, err := buildNetlist(circuit.Connections, circuitParts(puzzle.Components))
+	if err != nil {
+		return "", err
+	}
+	return circuitToSpice(puzzle.Name, netlist), nil
+}
+
+// parseSpiceValue parses a SPICE number with an optional engineering suffix (e.g. "4.7k", "1meg")
+func parseSpiceValue(s string) (float64, error) {
+	lower := strings.ToLower(s)
+	scales := []struct {
+		suffix   string
+		exponent int
+	}{
+		{"meg", 6}, {"t", 12}, {"g", 9}, {"k", 3}, {"m", -3}, {"u", -6}, {"n", -9}, {"p", -12}, {"f", -15},
+	}
+
+	// Find where the number ends; anything after the suffix (like a unit) is ignored
+	end := 0
+	for end < len(lower) && strings.ContainsRune("0123456789.+-e", rune(lower[end])) {
+		// An "e" only belongs to the number when an exponent follows
+		if lower[end] == 'e' && (end+1 >= len(lower) || !strings.ContainsRune("0123456789+-", rune(lower[end+1]))) {
+			break
+		}
+		end++
+	}
+	value, err := strconv.ParseFloat(lower[:end], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value '%s'", s)
+	}
+
+	rest := lower[end:]
+	for _, sc := range scales {
+		if strings.HasPrefix(rest, sc.suffix) {
+			// Divide for small scales so values like "220u" come out exact
+			if sc.exponent < 0 {
+				return value / math.Pow10(-sc.exponent), nil
+			}
+			return value * math.Pow10(sc.exponent), nil
+		}
+	}
+	return value, nil
+}
+
+// SpiceCircuit is a circuit read from a SPICE netlist
+type SpiceCircuit struct {
+	Title       string
+	Components  []Component
+	Connections []Connection
+}
+
+// spiceElementID derives a component ID from a SPICE element name
+// ("Rresistor1" becomes "resistor1", "R1" becomes "r1")
+func spiceElementID(name string) string {
+	rest := name[1:]
+	if rest == "" || !strings.ContainsAny(rest[:1], "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ") {
+		return strings.ToLower(name)
+	}
+	return rest
+}
+
+// ParseSpice reads the supported subset of a SPICE netlist: resistors (R),
+// capacitors (C), inductors (L), DC voltage sources (V), diodes (D) as LEDs
+// and NPN transistors (Q).
+// A resistor after a comment such as "* switch sw1 modelled as a resistor"
+// becomes that switch, buzzer or motor; switches are closed when their
+// resistance is at most one ohm. A resistor named after a source or
+// inductor with an "_int" suffix becomes its internal resistance.
+func ParseSpice(r io.Reader) (SpiceCircuit, error) {
+	var circuit SpiceCircuit
+
+	type element struct {
+		component Component
+		nodes     []string
+		model     string
+	}
+	var elements []element
+	models := make(map[string]map[string]float64)
+	// modelled holds the kinds of the parts marked as written as resistors
+	modelled := make(map[string]ComponentKind)
+
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if lineNumber == 1 {
+			// The first line of a SPICE deck is always its title
+			circuit.Title = strings.TrimSpace(strings.TrimPrefix(line, "*"))
+			continue
+		}
+		if i := strings.IndexAny(line, ";$"); i >= 0 {
+			line = strings.TrimSpace(line[:i])
+		}
+		if strings.HasPrefix(line, "*") {
+			fields := strings.Fields(strings.TrimPrefix(line, "*"))
+			if len(fields) >= 2 && strings.HasSuffix(line, spiceResistorMarker) {
+				modelled[fields[1]] = ComponentKind(strings.ToLower(fields[0]))
+			}
+			continue
+		}
+		if line == "" {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		name := fields[0]
+		if strings.HasPrefix(name, ".") {
+			if strings.EqualFold(name, ".model") && len(fields) >= 3 {
+				params, err := parseSpiceModelParams(strings.Join(fields[2:], " "))
+				if err != nil {
+					return circuit, fmt.Errorf("line %d: %v", lineNumber, err)
+				}
+				models[strings.ToLower(fields[1])] = params
+			}
+			continue
+		}
+
+		var e element
+		id := spiceElementID(name)
+		switch strings.ToUpper(name[:1]) {
+		case "R":
+			if len(fields) < 4 {
+				return circuit, fmt.Errorf("line %d: resistor needs two nodes and a value", lineNumber)
+			}
+			value, err := parseSpiceValue(fields[3])
+			if err != nil {
+				return circuit, fmt.Errorf("line %d: %v", lineNumber, err)
+			}
+			switch modelled[id] {
+			case KindSwitch:
+				e.component = Component{ID: id, Kind: KindSwitch, Closed: boolPtr(value <= 1)}
+			case KindBuzzer, KindMotor:
+				e.component = Component{ID: id, Kind: modelled[id], Resistance: value}
+			default:
+				e.component = Component{ID: id, Kind: KindResistor, Resistance: value}
+			}
+			e.nodes = fields[1:3]
+		case "V":
+			if len(fields) < 4 {
+				return circuit, fmt.Errorf("line %d: voltage source needs two nodes and a value", lineNumber)
+			}
+			valueField := fields[3]
+			if strings.EqualFold(valueField, "DC") && len(fields) >= 5 {
+				valueField = fields[4]
+			}
+			value, err := parseSpiceValue(valueField)
+			if err != nil {
+				return circuit, fmt.Errorf("line %d: %v", lineNumber, err)
+			}
+			// Battery pins are negative then positive, SPICE lists the positive node first
+			e.component = Component{ID: id, Kind: KindBattery, Voltage: value}
+			e.nodes = []string{fields[2], fields[1]}
+		case "D":
+			if len(fields) < 3 {
+				return circuit, fmt.Errorf("line %d: diode needs two nodes", lineNumber)
+			}
+			e.component = Component{ID: id, Kind: KindLED}
+			e.nodes = fields[1:3]
+			if len(fields) >= 4 {
+				e.model = strings.ToLower(fields[3])
+			}
+		case "C", "L":
+			if len(fields) < 4 {
+				return circuit, fmt.Errorf("line %d: %s needs two nodes and a value", lineNumber, name)
+			}
+			value, err := parseSpiceValue(fields[3])
+			if err != nil {
+				return circuit, fmt.Errorf("line %d: %v", lineNumber, err)
+			}
+			if strings.EqualFold(name[:1], "C") {
+				e.component = Component{ID: id, Kind: KindCapacitor, Capacitance: value}
+			} else {
+				e.component = Component{ID: id, Kind: KindInductor, Inductance: value}
+			}
+			e.nodes = fields[1:3]
+		case "Q":
+			if len(fields) < 4 {
+				return circuit, fmt.Errorf("line %d: transistor needs three nodes", lineNumber)
+			}
+			// SPICE orders transistor nodes collector, base, emitter
+			e.component = Component{ID: id, Kind: KindTransistor}
+			e.nodes = []string{fields[2], fields[1], fields[3]}
+			if len(fields) >= 5 {
+				e.model = strings.ToLower(fields[4])
+			}
+		default:
+			return circuit, fmt.Errorf("line %d: unsupported element '%s'", lineNumber, name)
+		}
+		elements = append(elements, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return circuit, fmt.Errorf("failed to read netlist: %v", err)
+	}
+
+	// Take LED and transistor parameters from their models
+	for i, e := range elements {
+		params := models[e.model]
+		switch e.component.Kind {
+		case KindLED:
+			if saturation := params["is"]; saturation > 0 {
+				emission := params["n"]
+				if emission == 0 {
+					emission = 1
+				}
+				forward := emission * spiceThermalVoltage * math.Log(spiceLEDCurrent/saturation)
+				elements[i].component.ForwardVoltage = math.Round(forward*100) / 100
+			}
+			elements[i].component.MaxReverseVoltage = params["bv"]
+		case KindTransistor:
+			elements[i].component.Gain = params["bf"]
+		}
+	}
+
+	// Fold internal resistors into their batteries and inductors
+	var kept []element
+	for _, e := range elements {
+		ownerID := strings.TrimSuffix(e.component.ID, spiceInternalSuffix)
+		folded := false
+		if e.component.Kind == KindResistor && ownerID != e.component.ID {
+			for i, owner := range elements {
+				if !strings.EqualFold(owner.component.ID, ownerID) || (owner.component.Kind != KindBattery && owner.component.Kind != KindInductor) {
+					continue
+				}
+				for k, node := range e.nodes {
+					if node == owner.nodes[1] {
+						if owner.component.Kind == KindBattery {
+							elements[i].component.InternalResistance = e.component.Resistance
+						} else {
+							elements[i].component.Resistance = e.component.Resistance
+						}
+						elements[i].nodes[1] = e.nodes[1-k]
+						folded = true
+						break
+					}
+				}
+			}
+		}
+		if !folded {
+			kept = append(kept, e)
+		}
+	}
+
+	// Chain the pins that share a node into connections
+	pinsByNode := make(map[string][]string)
+	var nodeOrder []string
+	seen := make(map[string]bool)
+	for _, e := range kept {
+		// Look the element up again, since folding may have moved its nodes
+		for _, current := range elements {
+			if current.component.ID == e.component.ID {
+				e = current
+				break
+			}
+		}
+		if seen[e.component.ID] {
+			return circuit, fmt.Errorf("duplicate element '%s'", e.component.ID)
+		}
+		seen[e.component.ID] = true
+		circuit.Components = append(circuit.Components, e.component)
+
+		for k, node := range e.nodes {
+			if _, ok := pinsByNode[node]; !ok {
+				nodeOrder = append(nodeOrder, node)
+			}
+			pinsByNode[node] = append(pinsByNode[node], e.component.ID+"."+e.component.Pins()[k])
+		}
+	}
+	for _, node := range nodeOrder {
+		pins := pinsByNode[node]
+		for k := 1; k < len(pins); k++ {
+			circuit.Connections = append(circuit.Connections, Connection{From: pins[k-1], To: pins[k]})
+		}
+	}
+
+	return circuit, nil
+}
+
+// parseSpiceModelParams parses the parameters of a model such as "D(IS=1e-14 N=2)"
+func parseSpiceModelParams(model string) (map[string]float64, error) {
+	params := make(map[string]float64)
+	if i := strings.Index(model, "("); i >= 0 {
+		model = strings.TrimSuffix(strings.TrimSpace(model[i+1:]), ")")
+	} else if fields := strings.Fields(model); len(fields) > 0 {
+		model = strings.Join(fields[1:], " ")
+	}
+
+	for _, field := range strings.FieldsFunc(model, func(r rune) bool { return r == ' ' || r == ',' }) {
+		parts := strings.SplitN(field, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		value, err := parseSpiceValue(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		params[strings.ToLower(parts[0])] = value
+	}
+	return params, nil
+}
+
+// SpiceToPuzzle builds a circuit puzzle from a parsed SPICE netlist
+func SpiceToPuzzle(id string, circuit SpiceCircuit) (Puzzle, error) {
+	if err := validateComponents(circuit.Components); err != nil {
+		return Puzzle{}, err
+	}
+
+	sort.SliceStable(circuit.Components, func(i, j int) bool {
+		return circuit.Components[i].Kind == KindBattery && circuit.Components[j].Kind != KindBattery
+	})
+	// Record the power states the netlist settles into as the expected ones
+	_, op, err := simulateCircuit(circuit.Connections, circuitParts(circuit.Components))
+	if err != nil {
+		return Puzzle{}, fmt.Errorf("failed to simulate netlist: %v", err)
+	}
+	solution, err := json.Marshal(CircuitSolution{Connections: circuit.Connections, PowerState: op.PowerStates()})
+	if err != nil {
+		return Puzzle{}, fmt.Errorf("failed to marshal circuit solution: %v", err)
+	}
+
+	name := circuit.Title
+	if name == "" {
+		name = id
+	}
+	return Puzzle{
+		ID:          id,
+		Type:        TypeCircuit,
+		Name:        name,
+		Description: fmt.Sprintf("Build the circuit described by the SPICE netlist '%s'", name),
+		Difficulty:  "Medium",
+		Components:  circuit.Components,
+		Solution:    solution,
+	}, nil
+}
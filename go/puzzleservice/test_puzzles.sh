@@ -9,14 +9,12 @@ RED='\033[0;31m'
 YELLOW='\033[0;33m'
 NC='\033[0m' # No Color
 
-# Build the puzzle service if it doesn't exist
-if [ ! -f ./puzzleservice ]; then
-    echo -e "${YELLOW}Building puzzle service...${NC}"
-    go build
-    if [ $? -ne 0 ]; then
-        echo -e "${RED}Failed to build puzzle service${NC}"
-        exit 1
-    fi
+# Build the puzzle service from the source in the tree
+echo -e "${YELLOW}Building puzzle service...${NC}"
+go build
+if [ $? -ne 0 ]; then
+    echo -e "${RED}Failed to build puzzle service${NC}"
+    exit 1
 fi
 
 # Create test directory
@@ -133,6 +131,28 @@ EOF
     "sequence": [2, 4, 6, 8, 10]
   }
 }
+EOF
+            ;;
+        "constraint")
+            cat > "$output_file" << EOF
+{
+  "puzzleId": "$puzzle_id",
+  "type": "$puzzle_type",
+  "solution": {
+    "values": {}
+  }
+}
+EOF
+            ;;
+        "rover")
+            cat > "$output_file" << EOF
+{
+  "puzzleId": "$puzzle_id",
+  "type": "$puzzle_type",
+  "solution": {
+    "program": "forward 1"
+  }
+}
 EOF
             ;;
     esac
@@ -177,6 +197,222 @@ for puzzle_file in ./samples/*.json; do
     fi
 done
 
+# Function to run a solution that must get a specific result and message
+run_targeted_test() {
+    local puzzle_id=$1
+    local puzzle_type=$2
+    local description=$3
+    local solution=$4
+    local expected_result=$5
+    local expected_message=$6
+    local solution_file="$TEST_DIR/${puzzle_id}_targeted.json"
+
+    cat > "$solution_file" << EOF
+{
+  "puzzleId": "$puzzle_id",
+  "type": "$puzzle_type",
+  "solution": $solution
+}
+EOF
+
+    echo -e "\n${YELLOW}Testing $puzzle_id ($description)...${NC}"
+    ./puzzleservice --file "$solution_file" > "$TEST_DIR/result.json"
+    if grep -q "\"valid\": $expected_result" "$TEST_DIR/result.json" && grep -qF -- "$expected_message" "$TEST_DIR/result.json"; then
+        echo -e "${GREEN}✓ Test passed for $puzzle_id ($description)${NC}"
+        return 0
+    else
+        echo -e "${RED}✗ Test failed for $puzzle_id ($description)${NC}"
+        echo "Expected result: \"valid\": $expected_result, with message: $expected_message"
+        echo "Actual result:"
+        cat "$TEST_DIR/result.json"
+        return 1
+    fi
+}
+
+# Incorrect solutions that get past the start and end checks to a rule of the puzzle
+run_targeted() {
+    total_tests=$((total_tests + 1))
+    if run_targeted_test "$1" "$2" "$3" "$4" false "$5"; then
+        passed_tests=$((passed_tests + 1))
+    fi
+}
+
+# Correct solutions written differently from the stored one
+run_accepted() {
+    total_tests=$((total_tests + 1))
+    if run_targeted_test "$1" "$2" "$3" "$4" true "$5"; then
+        passed_tests=$((passed_tests + 1))
+    fi
+}
+
+run_accepted circuit1 circuit "wire written against the current" \
+    '{"connections": [{"from": "battery", "to": "switch"}, {"from": "switch", "to": "led"}, {"from": "led", "to": "resistor"}, {"from": "battery", "to": "resistor"}]}' \
+    "Circuit solution is correct"
+
+run_targeted maze_basic maze "wall crossed on the way to the goal" \
+    '{"path": [{"x": 0, "y": 0}, {"x": 0, "y": 1}, {"x": 0, "y": 2}, {"x": 1, "y": 2}, {"x": 2, "y": 2}, {"x": 2, "y": 3}, {"x": 3, "y": 3}, {"x": 3, "y": 4}, {"x": 4, "y": 4}, {"x": 4, "y": 5}, {"x": 5, "y": 5}]}' \
+    "wall between (4,4) and (4,5) crossed"
+run_targeted maze_keys maze "door entered without its key" \
+    '{"path": [{"x": 0, "y": 0}, {"x": 1, "y": 0}, {"x": 2, "y": 0}, {"x": 3, "y": 0}, {"x": 3, "y": 1}, {"x": 3, "y": 2}, {"x": 4, "y": 2}, {"x": 5, "y": 2}, {"x": 6, "y": 2}]}' \
+    "door at (4,2) entered without key 'brass'"
+run_targeted maze_robots maze "agents collide" \
+    '{"paths": {"picker": [{"x": 0, "y": 0}, {"x": 1, "y": 0}, {"x": 2, "y": 0}, {"x": 3, "y": 0}, {"x": 4, "y": 0}], "loader": [{"x": 4, "y": 0}, {"x": 3, "y": 0}, {"x": 2, "y": 0}, {"x": 1, "y": 0}, {"x": 0, "y": 0}]}}' \
+    "are both on (2,0) at time 2"
+run_targeted logic_kmap logic "equivalent but not minimal" \
+    '{"expression": "(NOT B AND NOT D) OR (B AND D) OR (A AND B AND D)"}' \
+    "Expression is equivalent but not minimal"
+
+# Circuit hazards
+run_targeted circuit1 circuit "battery shorted through the switch" \
+    '{"connections": [{"from": "battery", "to": "switch"}, {"from": "switch", "to": "battery"}]}' \
+    "Battery 'battery' is short-circuited"
+run_targeted circuit1 circuit "LED without a resistor burns out" \
+    '{"connections": [{"from": "battery", "to": "led"}, {"from": "led", "to": "battery"}]}' \
+    "LED 'led' burns out"
+
+# Circuit goal scenarios
+run_targeted circuit_goals circuit "switches in parallel instead of in series" \
+    '{"connections": [{"from": "battery.positive", "to": "switch1.a"}, {"from": "battery.positive", "to": "switch2.a"}, {"from": "switch1.b", "to": "led1.anode"}, {"from": "switch2.b", "to": "led1.anode"}, {"from": "led1.cathode", "to": "resistor1.a"}, {"from": "resistor1.b", "to": "battery.negative"}]}' \
+    "Circuit fails 2 of 4 scenarios"
+
+# Transient circuits
+run_targeted circuit_timer circuit "capacitor across the battery instead of the LED" \
+    '{"connections": [{"from": "battery.positive", "to": "switch1.a"}, {"from": "battery.positive", "to": "capacitor1.a"}, {"from": "capacitor1.b", "to": "battery.negative"}, {"from": "switch1.b", "to": "led1.anode"}, {"from": "led1.cathode", "to": "resistor1.a"}, {"from": "resistor1.b", "to": "battery.negative"}]}' \
+    "stays on for 0 ms after switch1 opens, expected at least 200 ms"
+
+# Circuit diagnostics
+run_targeted circuit1 circuit "LED left out of the loop" \
+    '{"connections": [{"from": "battery", "to": "switch"}, {"from": "switch", "to": "resistor"}, {"from": "resistor", "to": "battery"}]}' \
+    "Circuit topology does not match the puzzle: 2 missing and 1 extra connections"
+
+# Logic expressions
+run_targeted logic_advanced logic "assignment breaking one clause" \
+    '{"values": {"A": true, "B": false, "C": true, "D": true, "E": false}}' \
+    '"failedClause": "C XOR D"'
+run_targeted logic_advanced logic "variable the expression does not have" \
+    '{"values": {"A": true, "B": false, "C": true, "D": false, "E": false, "F": true}}' \
+    "'F' is not a variable of this puzzle"
+
+# Gate networks
+run_targeted logic_gates logic "OR gate where the sum needs XOR" \
+    '{"gates": [{"id": "g1", "type": "OR", "inputs": ["A", "B"]}, {"id": "g2", "type": "AND", "inputs": ["A", "B"]}], "outputs": {"SUM": "g1", "CARRY": "g2"}}' \
+    "Logic circuit gives wrong outputs for 1 of 4 input rows"
+run_targeted logic_majority logic "gate type the puzzle does not allow" \
+    '{"gates": [{"id": "ab", "type": "AND", "inputs": ["A", "B"]}, {"id": "out", "type": "NAND", "inputs": ["ab", "C"]}], "outputs": {"OUT": "out"}}' \
+    "Gate 'ab' is of type AND, but only NAND gates may be used"
+
+# Sequential logic
+run_targeted logic_counter logic "second bit toggled without the enable" \
+    '{"gates": [{"id": "t0", "type": "TFF", "inputs": ["EN"]}, {"id": "t1", "type": "TFF", "inputs": ["t0"]}], "outputs": {"Q0": "t0", "Q1": "t1"}}' \
+    '"firstDivergentCycle": 6'
+
+# Constraint puzzles
+run_targeted constraint_sensors constraint "hub on the roof breaks the implication" \
+    '{"values": {"temperature": 1, "smoke": 2, "motion": 3, "hub": "roof"}}' \
+    "1 of 6 constraints are violated: A smoke sensor on floor 2 is wired to a hub in the basement"
+run_targeted constraint_sensors constraint "value outside the domain" \
+    '{"values": {"temperature": 1, "smoke": 2, "motion": 4, "hub": "basement"}}' \
+    "'4' is not a possible value of 'motion'"
+
+# Path scoring
+maze_detour='{"path": [{"x": 0, "y": 0}, {"x": 1, "y": 0}, {"x": 2, "y": 0}, {"x": 2, "y": 1}, {"x": 2, "y": 2}, {"x": 3, "y": 2}, {"x": 4, "y": 2}, {"x": 4, "y": 3}, {"x": 4, "y": 4}, {"x": 4, "y": 5}, {"x": 4, "y": 6}, {"x": 4, "y": 5}, {"x": 4, "y": 4}, {"x": 5, "y": 4}, {"x": 6, "y": 4}, {"x": 6, "y": 5}, {"x": 6, "y": 6}, {"x": 7, "y": 6}, {"x": 8, "y": 6}, {"x": 8, "y": 7}, {"x": 8, "y": 8}, {"x": 9, "y": 8}, {"x": 9, "y": 9}]}'
+run_targeted maze_advanced maze "detour into a dead end" "$maze_detour" \
+    "Path takes 22 steps, but it must be a shortest path of 18 steps"
+
+# Rover programs
+run_targeted rover_warehouse rover "rover driven into a shelf" \
+    '{"program": "turn right\nforward 1"}' \
+    "Rover crashed at step 2 (line 2): blocked cell (0,1) entered"
+run_targeted rover_warehouse rover "rover turning on the spot" \
+    '{"program": "repeat 100 { turn left }"}' \
+    "Rover used up its budget of 60 steps at (0,0)"
+
+# Rule-based patterns
+run_targeted pattern_interleaved pattern "one wrong term of the arithmetic rule" \
+    '{"sequence": [7, 16, 10, 32]}' \
+    '"firstWrongTerm": 8'
+run_targeted pattern_interleaved pattern "last term missing" \
+    '{"sequence": [7, 16, 9]}' \
+    '"firstWrongTerm": 9'
+
+# Function to run a command whose output must contain a given text
+run_command_test() {
+    local description=$1
+    local expected_output=$2
+    shift 2
+
+    echo -e "\n${YELLOW}Testing $description...${NC}"
+    "$@" > "$TEST_DIR/result.txt" 2>&1
+    if grep -qF -- "$expected_output" "$TEST_DIR/result.txt"; then
+        echo -e "${GREEN}✓ Test passed for $description${NC}"
+        return 0
+    else
+        echo -e "${RED}✗ Test failed for $description${NC}"
+        echo "Expected output containing: $expected_output"
+        echo "Actual output:"
+        cat "$TEST_DIR/result.txt"
+        return 1
+    fi
+}
+
+# Commands other than verification
+run_command() {
+    total_tests=$((total_tests + 1))
+    if run_command_test "$@"; then
+        passed_tests=$((passed_tests + 1))
+    fi
+}
+
+run_command "schematic of a stored circuit" '<g id="led">' \
+    ./puzzleservice --render circuit1
+run_command "schematic of a submission with missing wires" 'stroke="#ff7f0e"' \
+    ./puzzleservice --render circuit1 --file examples/circuit1_incorrect.json
+run_command "satisfiability of a puzzle with a unique solution" '[1,true,true]' \
+    bash -c "./puzzleservice --sat logic_basic | grep -v '^Loaded' | jq -c '[.count, .satisfiable, .unique]'"
+run_command "satisfiability of an expression with several solutions" '[3,true,false]' \
+    bash -c "./puzzleservice --sat 'A OR B' | grep -v '^Loaded' | jq -c '[.count, .satisfiable, .unique]'"
+run_command "satisfiability of a contradiction" '[0,false,false]' \
+    bash -c "./puzzleservice --sat 'A AND NOT A' | grep -v '^Loaded' | jq -c '[.count, .satisfiable, .unique]'"
+run_command "path score of a detour" '[22,18,4,2]' \
+    bash -c "./puzzleservice --json '{\"puzzleId\": \"maze_advanced\", \"solution\": $maze_detour}' | grep -v '^Loaded' | jq -c '.pathScore | [.steps, .optimalSteps, .extraSteps, (.revisitedCells | length)]'"
+
+# Generated mazes, compared by their grids
+generated_maze() {
+    ./puzzleservice --generate-maze "$1" --maze-size 8x8 | grep -v '^Loaded' | jq -c .maze
+}
+maze_42=$(generated_maze 42)
+run_command "generated maze repeats for the same seed" "same maze" \
+    bash -c '[ -n "$1" ] && [ "$1" = "$2" ] && echo same maze' _ "$maze_42" "$(generated_maze 42)"
+run_command "generated maze changes with the seed" "different maze" \
+    bash -c '[ -n "$1" ] && [ "$1" != "$2" ] && echo different maze' _ "$maze_42" "$(generated_maze 43)"
+
+# Maze sessions, walked along the stored path of the fog maze
+session_id=$(./puzzleservice --open-session maze_fog | grep -v '^Loaded' | jq -r .id)
+run_command "session move off the grid" "Move rejected: (0,-1) is outside the maze" \
+    ./puzzleservice --session "$session_id" --move north
+for move in south south east east east south south east east north north east east south; do
+    ./puzzleservice --session "$session_id" --move "$move" > /dev/null
+done
+run_command "session move onto the goal" "Goal reached in 15 moves; the shortest path takes 15" \
+    ./puzzleservice --session "$session_id" --move south
+run_command "session move after the goal" "Session is finished: the goal was reached in 15 moves" \
+    ./puzzleservice --session "$session_id" --move north
+rm -f "$HOME/.jemulator/sessions/$session_id.json"
+run_command "session with a malformed ID" "invalid session ID 'not-hex'" \
+    ./puzzleservice --session not-hex
+run_command "session that does not exist" "session not found: 0000000000000000" \
+    ./puzzleservice --session 0000000000000000
+run_command "render of a maze hidden by fog" "hidden by fog" \
+    ./puzzleservice --render maze_fog
+run_command "diagnostics of an unsafe circuit" "[true,true,true,true]" \
+    bash -c "./puzzleservice --file examples/circuit1_incorrect.json | grep -v '^Loaded' | jq -c '.diagnostics | [has(\"missingConnections\"), has(\"extraConnections\"), has(\"powerStateMismatches\"), has(\"nodeVoltages\")]'"
+
+run_command "SPICE round trip of a stored circuit" '["battery","switch","led","resistor"]' \
+    bash -c "./puzzleservice --to-spice circuit1 --output $TEST_DIR/circuit1.cir > /dev/null && ./puzzleservice --from-spice $TEST_DIR/circuit1.cir | grep -v '^Loaded' | jq -c '[.components[].kind]'"
+printf '* Lamp\nVbattery 1 0 DC 9\n* switch s1 modelled as a resistor\nRs1 1 2 1m\nDled 2 3 LEDM\nRr1 3 0 470\n.model LEDM D(IS=1e-19 N=2)\n.end\n' > "$TEST_DIR/lamp.cir"
+run_command "SPICE round trip of a switch not named like one" "* switch s1 modelled as a resistor" \
+    bash -c "mkdir -p $TEST_DIR/spice/puzzles && ./puzzleservice --config $TEST_DIR/spice --from-spice $TEST_DIR/lamp.cir > $TEST_DIR/spice/puzzles/lamp.json && ./puzzleservice --config $TEST_DIR/spice --to-spice lamp"
+
 # Print summary
 echo -e "\n${YELLOW}Test Summary:${NC}"
 echo -e "Total tests: $total_tests"
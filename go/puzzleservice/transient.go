@@ -0,0 +1,378 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Limits of a transient simulation
+const (
+	// defaultTransientSteps is the number of time steps used when a puzzle gives no step
+	defaultTransientSteps = 1000
+	// maxTransientSteps bounds the length of a transient simulation
+	maxTransientSteps = 100000
+	// maxWaveformSamples bounds the number of samples returned per node
+	maxWaveformSamples = 200
+)
+
+// TransientAnalysis describes a time-stepped simulation of a circuit puzzle.
+// The circuit starts in its steady state, switches change at the listed
+// times, and the waveform assertions are checked against the result.
+type TransientAnalysis struct {
+	// Duration is the simulated time in seconds
+	Duration float64 `json:"duration"`
+	// Step is the time step in seconds (Duration/1000 by default)
+	Step       float64             `json:"step,omitempty"`
+	Events     []SwitchEvent       `json:"events,omitempty"`
+	Assertions []WaveformAssertion `json:"assertions"`
+}
+
+// SwitchEvent opens or closes a switch at a point in time
+type SwitchEvent struct {
+	// Name identifies the event in assertions ("switch1 opens" by default)
+	Name   string  `json:"name,omitempty"`
+	Time   float64 `json:"time"`
+	Switch string  `json:"switch"`
+	Closed bool    `json:"closed"`
+}
+
+// WaveformAssertion requires a component to stay powered (or unpowered)
+// for a while after an event, such as "led1 on for at least 200 ms after
+// switch1 opens"
+type WaveformAssertion struct {
+	Name        string `json:"name,omitempty"`
+	ComponentID string `json:"componentId"`
+	Powered     bool   `json:"powered"`
+	// After names the event the assertion is measured from; it is measured
+	// from the start of the simulation when empty
+	After string `json:"after,omitempty"`
+	// MinDuration is how long in seconds the state must hold at least
+	MinDuration float64 `json:"minDuration,omitempty"`
+	// MaxDuration is how long in seconds the state may hold at most before it changes
+	MaxDuration float64 `json:"maxDuration,omitempty"`
+}
+
+// AssertionResult represents the outcome of checking one waveform assertion
+type AssertionResult struct {
+	Name   string `json:"name"`
+	Passed bool   `json:"passed"`
+	// Duration is how long in seconds the asserted state held
+	Duration float64 `json:"duration"`
+	Message  string  `json:"message,omitempty"`
+}
+
+// NodeWaveform holds the sampled voltage of a circuit node
+type NodeWaveform struct {
+	// Node is the node name, "0" being the negative terminal of the first battery
+	Node string `json:"node"`
+	// Pins lists the component pins joined at the node
+	Pins     []string  `json:"pins"`
+	Voltages []float64 `json:"voltages"`
+}
+
+// TransientResult holds the waveforms and assertion outcomes of a transient simulation
+type TransientResult struct {
+	// Times holds the time of each sample in seconds
+	Times      []float64         `json:"times"`
+	Nodes      []NodeWaveform    `json:"nodes"`
+	Assertions []AssertionResult `json:"assertions"`
+}
+
+// transientState carries what capacitors and inductors store from one time step to the next
+type transientState struct {
+	Step              float64
+	CapacitorVoltages map[string]float64
+	InductorCurrents  map[string]float64
+}
+
+// companion returns the conductance and parallel current source standing in
+// for a capacitor or inductor over one backward Euler time step. Without a
+// state the component is in steady state: a capacitor is open and an
+// inductor is its winding resistance.
+func (s *transientState) companion(c circuitComponent) (float64, float64) {
+	switch c.Kind {
+	case KindCapacitor:
+		if s == nil {
+			return minConductance, 0
+		}
+		// i = C (v - v_prev) / dt
+		g := c.Capacitance / s.Step
+		return g, -g * s.CapacitorVoltages[c.ID]
+	case KindInductor:
+		if s == nil {
+			return 1 / c.Resistance, 0
+		}
+		// v = L (i - i_prev) / dt + R i
+		reactance := c.Inductance / s.Step
+		g := 1 / (c.Resistance + reactance)
+		return g, g * reactance * s.InductorCurrents[c.ID]
+	}
+	return 0, 0
+}
+
+// eventName returns the name of an event, describing it if it has none
+func eventName(event SwitchEvent) string {
+	if event.Name != "" {
+		return event.Name
+	}
+	if event.Closed {
+		return event.Switch + " closes"
+	}
+	return event.Switch + " opens"
+}
+
+// assertionName returns the name of an assertion, describing it if it has none
+func assertionName(assertion WaveformAssertion) string {
+	if assertion.Name != "" {
+		return assertion.Name
+	}
+	name := assertion.ComponentID + " " + powerWord(assertion.Powered)
+	if assertion.After != "" {
+		name += " after " + assertion.After
+	}
+	return name
+}
+
+// powerWord describes a power state as "on" or "off"
+func powerWord(powered bool) string {
+	if powered {
+		return "on"
+	}
+	return "off"
+}
+
+// validateTransient checks that a transient analysis is well formed
+func validateTransient(analysis *TransientAnalysis) error {
+	if analysis == nil {
+		return nil
+	}
+	if analysis.Duration <= 0 || analysis.Step < 0 {
+		return fmt.Errorf("transient duration must be positive and step must not be negative")
+	}
+	if analysis.Step > 0 && analysis.Duration/analysis.Step > maxTransientSteps {
+		return fmt.Errorf("transient simulation needs more than %d steps", maxTransientSteps)
+	}
+
+	events := make(map[string]bool)
+	for _, event := range analysis.Events {
+		if event.Time < 0 || event.Time > analysis.Duration {
+			return fmt.Errorf("event '%s' is outside the simulated time", eventName(event))
+		}
+		events[eventName(event)] = true
+	}
+	for _, assertion := range analysis.Assertions {
+		if assertion.After != "" && !events[assertion.After] {
+			return fmt.Errorf("assertion '%s' refers to unknown event '%s'", assertionName(assertion), assertion.After)
+		}
+	}
+	return nil
+}
+
+// transientRun is the outcome of simulating a netlist over time
+type transientRun struct {
+	Step  float64
+	Times []float64
+	// Powered holds the power state of each component at every step
+	Powered map[string][]bool
+	// Voltages holds the node voltages at every step, relative to node "0"
+	Voltages [][]float64
+	Hazards  []CircuitHazard
+}
+
+// simulateTransient steps a netlist through time, starting from its steady
+// state and applying the switch events as their times are reached
+func simulateTransient(netlist circuitNetlist, analysis TransientAnalysis) (transientRun, error) {
+	run := transientRun{Step: analysis.Step, Powered: make(map[string][]bool)}
+	if run.Step == 0 {
+		run.Step = analysis.Duration / defaultTransientSteps
+	}
+	steps := int(math.Round(analysis.Duration / run.Step))
+
+	ground := 0
+	for _, c := range netlist.Components {
+		if c.Kind == KindBattery {
+			ground = c.Nodes[0]
+			break
+		}
+	}
+
+	switches := make(map[string]bool)
+	applyEvents := func(time float64) {
+		for _, event := range analysis.Events {
+			if event.Time <= time+run.Step/2 {
+				switches[event.Switch] = event.Closed
+			}
+		}
+	}
+
+	var state *transientState
+	for step := 0; step <= steps; step++ {
+		time := float64(step) * run.Step
+		applyEvents(time)
+		stepNetlist := netlist.withSwitches(switches)
+
+		op, err := solveNetlist(stepNetlist, state)
+		if err != nil {
+			return run, fmt.Errorf("at %.3f s: %v", time, err)
+		}
+
+		run.Times = append(run.Times, time)
+		voltages := make([]float64, len(op.Voltages))
+		for node, v := range op.Voltages {
+			voltages[node] = v - op.Voltages[ground]
+		}
+		run.Voltages = append(run.Voltages, voltages)
+		for id, powered := range op.Powered {
+			run.Powered[id] = append(run.Powered[id], powered)
+		}
+		run.Hazards = mergeHazards(run.Hazards, detectHazards(stepNetlist, op))
+
+		// Carry the capacitor voltages and inductor currents into the next step
+		state = &transientState{
+			Step:              run.Step,
+			CapacitorVoltages: make(map[string]float64),
+			InductorCurrents:  make(map[string]float64),
+		}
+		for _, c := range stepNetlist.Components {
+			switch c.Kind {
+			case KindCapacitor:
+				state.CapacitorVoltages[c.ID] = op.drop(c)
+			case KindInductor:
+				state.InductorCurrents[c.ID] = op.Currents[c.ID]
+			}
+		}
+	}
+
+	return run, nil
+}
+
+// checkAssertion measures how long the asserted state holds from the start
+// time and compares it with the assertion's bounds
+func (run transientRun) checkAssertion(assertion WaveformAssertion, start float64) AssertionResult {
+	result := AssertionResult{Name: assertionName(assertion)}
+	states, ok := run.Powered[assertion.ComponentID]
+	if !ok {
+		result.Message = fmt.Sprintf("Component '%s' is not in the circuit", assertion.ComponentID)
+		return result
+	}
+
+	first := int(math.Ceil(start/run.Step - 1e-9))
+	changed := false
+	for i := first; i < len(states); i++ {
+		if states[i] != assertion.Powered {
+			result.Duration = run.Times[i] - start
+			changed = true
+			break
+		}
+	}
+	if !changed {
+		result.Duration = run.Times[len(run.Times)-1] - start
+	}
+
+	when := ""
+	if assertion.After != "" {
+		when = " after " + assertion.After
+	}
+	state := powerWord(assertion.Powered)
+	tolerance := run.Step / 2
+
+	switch {
+	case result.Duration == 0 && assertion.MinDuration == 0:
+		result.Message = fmt.Sprintf("'%s' is not %s%s", assertion.ComponentID, state, when)
+	case result.Duration < assertion.MinDuration-tolerance:
+		result.Message = fmt.Sprintf("'%s' stays %s for %.0f ms%s, expected at least %.0f ms",
+			assertion.ComponentID, state, result.Duration*1000, when, assertion.MinDuration*1000)
+	case assertion.MaxDuration > 0 && (!changed || result.Duration > assertion.MaxDuration+tolerance):
+		result.Message = fmt.Sprintf("'%s' stays %s for %.0f ms%s, expected at most %.0f ms",
+			assertion.ComponentID, state, result.Duration*1000, when, assertion.MaxDuration*1000)
+	default:
+		result.Passed = true
+	}
+	return result
+}
+
+// waveforms samples the node voltages of a run for plotting
+func (run transientRun) waveforms(netlist circuitNetlist) ([]float64, []NodeWaveform) {
+	stride := (len(run.Times) + maxWaveformSamples - 1) / maxWaveformSamples
+	var samples []int
+	for i := 0; i < len(run.Times); i += stride {
+		samples = append(samples, i)
+	}
+	if last := len(run.Times) - 1; samples[len(samples)-1] != last {
+		samples = append(samples, last)
+	}
+
+	times := make([]float64, len(samples))
+	for k, i := range samples {
+		times[k] = run.Times[i]
+	}
+
+	names := spiceNodeNames(netlist)
+	nodes := make([]NodeWaveform, netlist.NodeCount)
+	for node := range nodes {
+		nodes[node].Node = names[node]
+		nodes[node].Voltages = make([]float64, len(samples))
+		for k, i := range samples {
+			nodes[node].Voltages[k] = run.Voltages[i][node]
+		}
+	}
+	for _, c := range netlist.Components {
+		for k, node := range c.Nodes {
+			nodes[node].Pins = append(nodes[node].Pins, c.ID+"."+c.Pins()[k])
+		}
+	}
+	return times, nodes
+}
+
+// verifyCircuitTransient simulates a submitted circuit over time and checks
+// every waveform assertion, accepting any wiring that meets them all
+func verifyCircuitTransient(result PuzzleVerificationResult, analysis TransientAnalysis, netlist circuitNetlist) PuzzleVerificationResult {
+	for _, event := range analysis.Events {
+		if c, ok := netlist.component(event.Switch); !ok || c.Kind != KindSwitch {
+			result.Message = fmt.Sprintf("Switch '%s' is not in the circuit", event.Switch)
+			return result
+		}
+	}
+
+	run, err := simulateTransient(netlist, analysis)
+	if err != nil {
+		result.Message = fmt.Sprintf("Failed to simulate circuit over time: %v", err)
+		return result
+	}
+	result.Hazards = mergeHazards(result.Hazards, run.Hazards)
+
+	waveform := &TransientResult{}
+	waveform.Times, waveform.Nodes = run.waveforms(netlist)
+	result.Waveform = waveform
+
+	var failed []string
+	for _, assertion := range analysis.Assertions {
+		start := 0.0
+		for _, event := range analysis.Events {
+			if eventName(event) == assertion.After {
+				start = event.Time
+			}
+		}
+		assertionResult := run.checkAssertion(assertion, start)
+		waveform.Assertions = append(waveform.Assertions, assertionResult)
+		if !assertionResult.Passed {
+			failed = append(failed, assertionResult.Message)
+		}
+	}
+
+	if len(result.Hazards) > 0 {
+		result.Message = fmt.Sprintf("Circuit is unsafe: %s", result.Hazards[0].Message)
+		return result
+	}
+
+	if len(failed) > 0 {
+		result.Message = fmt.Sprintf("Circuit fails %d of %d waveform assertions: %s",
+			len(failed), len(analysis.Assertions), strings.Join(failed, "; "))
+		return result
+	}
+
+	result.Valid = true
+	result.Message = "Circuit meets all waveform assertions"
+	return result
+}